@@ -0,0 +1,88 @@
+package goman
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Read the uncompressed source of the sample man page
+func readTestPage(b *testing.B) []byte {
+	fil, err := os.Open("./test.1.gz")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fil.Close()
+	rdr, err := gzip.NewReader(fil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// Build a page with 'nopts' options and 'nparas' paragraphs of description,
+// roughly the shape of a large page such as bash(1).
+func makePage(nopts, nparas int) []byte {
+	var b strings.Builder
+	b.WriteString(".TH BIG 1\n.SH NAME\nbig \\- a large page\n")
+	b.WriteString(".SH SYNOPSIS\n.B big\n[options] file...\n.SH DESCRIPTION\n")
+	for i := 0; i < nparas; i++ {
+		fmt.Fprintf(&b, ".PP\nParagraph %d describes the program at some\n"+
+			"length, wrapping over several lines of\nroff source text.\n", i)
+	}
+	b.WriteString(".SH OPTIONS\n")
+	for i := 0; i < nopts; i++ {
+		fmt.Fprintf(&b, ".IP -opt%d\nOption %d does something useful.\n", i, i)
+	}
+	b.WriteString(".SH BUGS\nNone known.\n")
+	return []byte(b.String())
+}
+
+func benchmarkParse(b *testing.B, data []byte, opts ...ParseOption) {
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := NewManPageFromBytes(data, opts...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseSmall(b *testing.B) {
+	benchmarkParse(b, readTestPage(b))
+}
+
+func BenchmarkParseLarge(b *testing.B) {
+	benchmarkParse(b, makePage(100, 1000))
+}
+
+func BenchmarkParseManyOptions(b *testing.B) {
+	benchmarkParse(b, makePage(1000, 10))
+}
+
+func BenchmarkParseNameOnly(b *testing.B) {
+	benchmarkParse(b, makePage(1000, 10), WithFields(FieldName))
+}
+
+func BenchmarkParseOpts(b *testing.B) {
+	man, _ := NewManPageFromBytes(makePage(1000, 10))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		man.Opts = nil
+		man.parseOpts()
+	}
+}
+
+func BenchmarkGetSection(b *testing.B) {
+	man, _ := NewManPageFromBytes(makePage(100, 1000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		man.getSection("DESCRIPTION")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// cat - Parsing of already formatted "cat" pages.
+package goman
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Lines that are roff requests or macros
+var roff_line_re = regexp.MustCompilePOSIX(`^['.][ \t]*[A-Za-z\\]`)
+
+// Section headings of a formatted page start in the first column
+var cat_heading_re = regexp.MustCompilePOSIX(`^[A-Z][A-Z0-9 ]*$`)
+
+// Overstrikes that embolden ("a\ba") or underline ("_\ba") a character
+var overstrike_re = regexp.MustCompile(`.\x08`)
+
+// Report whether 'data' is an already formatted page: it has section
+// headings but no roff macros at all.
+func isCat(data string) bool {
+	return !roff_line_re.MatchString(data) && cat_heading_re.MatchString(data)
+}
+
+// Remove the overstrikes used for bold and underlined text
+func stripOverstrike(str string) string {
+	return overstrike_re.ReplaceAllString(str, "")
+}
+
+// Return the plain text of the formatted section 'name', and whether the
+// section exists.  Paragraphs are separated by a blank line.
+func (m *ManPage) getCatSection(name string) (string, bool) {
+	var lines []string
+	found := false
+	for _, line := range strings.Split(m.data, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if cat_heading_re.MatchString(line) {
+			if found {
+				break
+			}
+			found = line == name
+			continue
+		}
+		if found {
+			lines = append(lines, line)
+		}
+	}
+	return catText(lines), found
+}
+
+// Join the formatted 'lines' of a section into paragraphs separated by a
+// blank line
+func catText(lines []string) string {
+	text := ""
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			text += "\n\n"
+		} else {
+			text += " " + line
+		}
+	}
+	return joinParagraphs(text)
+}
+
+// Parse all of the interesting parts of a formatted page
+func (m *ManPage) parseCat() {
+	m.data = stripOverstrike(m.data)
+	sect, _ := m.getCatSection("NAME")
+	m.Name = strings.TrimRight(strings.Split(sect, " ")[0], ",")
+	m.Summary = nameSummary(sect)
+
+	if m.wants(FieldDesc) {
+		var ok bool
+		if m.Desc, ok = m.aliasedSection("DESCRIPTION"); !ok {
+			m.Desc = m.Summary
+		}
+	}
+	if m.wants(FieldSynopsis) {
+		m.Synopsis, _ = m.getCatSection("SYNOPSIS")
+	}
+	if m.wants(FieldExamples) {
+		m.Examples, _ = m.aliasedSection("EXAMPLES")
+	}
+	if m.wants(FieldBugs) {
+		m.Bugs, _ = m.aliasedSection("BUGS")
+	}
+	if m.wants(FieldNotes) {
+		m.parseNotes()
+	}
+	if m.wants(FieldStandards) {
+		m.parseStandards()
+	}
+	if m.wants(FieldKeywords) {
+		m.parseKeywords()
+	}
+	if m.wants(FieldCopyright) {
+		m.parseCopyright()
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// compress - Detection and decompression of compressed man pages.
+package goman
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Compression identifies how the contents of a man page file are compressed.
+type Compression int
+
+const (
+	None Compression = iota
+	Gzip
+	Bzip2
+	Xz
+	Zstd
+	LZW
+	LZ4
+)
+
+var compression_names = map[Compression]string{
+	None:  "none",
+	Gzip:  "gzip",
+	Bzip2: "bzip2",
+	Xz:    "xz",
+	Zstd:  "zstd",
+	LZW:   "lzw",
+	LZ4:   "lz4",
+}
+
+// The leading bytes identifying each compressed format
+var compression_magic = []struct {
+	magic []byte
+	comp  Compression
+}{
+	{[]byte{0x1f, 0x8b}, Gzip},
+	{[]byte("BZh"), Bzip2},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, Xz},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, Zstd},
+	{[]byte{0x1f, 0x9d}, LZW},
+	{[]byte{0x04, 0x22, 0x4d, 0x18}, LZ4},
+}
+
+// The number of leading bytes DetectFormat needs to identify any format
+const magic_len = 6
+
+func (c Compression) String() string {
+	if name, ok := compression_names[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+// The file name suffixes of compressed man pages
+var compression_suffixes = []string{".gz", ".bz2", ".xz", ".zst", ".Z", ".lz4"}
+
+// Return the file name 'name' without the suffix of its compression, e.g.
+// ls.1 for ls.1.bz2
+func stripCompression(name string) string {
+	for _, suffix := range compression_suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// DetectFormat identifies the compression of a file from its first bytes.
+// Six bytes suffice for every format; anything unrecognized is None.
+func DetectFormat(header []byte) Compression {
+	for _, m := range compression_magic {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.comp
+		}
+	}
+	return None
+}
+
+// Return a reader of the decompressed contents of 'r', detecting its
+// compression from the leading bytes.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	buf := bufio.NewReader(r)
+	header, _ := buf.Peek(magic_len)
+
+	switch comp := DetectFormat(header); comp {
+	case None:
+		return ioutil.NopCloser(buf), nil
+	case Gzip:
+		zrdr, err := gzip.NewReader(buf)
+		if err != nil {
+			return nil, fmt.Errorf("error building a reader: %w", err)
+		}
+		return zrdr, nil
+	case Bzip2:
+		return ioutil.NopCloser(bzip2.NewReader(buf)), nil
+	case LZ4:
+		data, err := readLZ4(buf)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing lz4: %w", err)
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	default:
+		return nil, fmt.Errorf("unsupported man page compression: %v", comp)
+	}
+}
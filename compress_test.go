@@ -0,0 +1,150 @@
+package goman
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		header []byte
+		comp   Compression
+	}{
+		{[]byte{0x1f, 0x8b, 0x08, 0x00}, Gzip},
+		{[]byte("BZh91AY"), Bzip2},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, Xz},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, Zstd},
+		{[]byte{0x1f, 0x9d, 0x90}, LZW},
+		{[]byte(".TH FOO 1"), None},
+		{[]byte{0x1f}, None},
+		{nil, None},
+	}
+	for _, test := range tests {
+		if comp := DetectFormat(test.header); comp != test.comp {
+			t.Errorf("DetectFormat: expected %v for %q, found %v\n", test.comp, test.header, comp)
+		}
+	}
+}
+
+func TestBzip2(t *testing.T) {
+	gz, err := NewManPage("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bz, err := NewManPage("./test.1.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gz.String() != bz.String() {
+		t.Errorf("NewManPage: expected '%s', found '%s'\n", gz, bz)
+	}
+}
+
+// bare.1.gz was written by a gzip.Writer with an empty header: it has no
+// file name and a zero modification time.
+func TestMinimalGzipHeader(t *testing.T) {
+	man, err := NewManPage("./bare.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Name != "bare" || man.Summary != "minimal gzip header" {
+		t.Errorf("NAME: expected 'bare' and 'minimal gzip header', found '%s' and '%s'\n",
+			man.Name, man.Summary)
+	}
+	if len(man.Opts) != 1 || man.Opts[0].Name != "-q" {
+		t.Errorf("Opts: expected [-q], found %v\n", man.Opts)
+	}
+}
+
+func TestXXH32(t *testing.T) {
+	tests := map[string]uint32{
+		"":    0x02cc5d05,
+		"abc": 0x32d153ff,
+		"Nobody inspects the spammish repetition": 0xe2293b2f,
+	}
+	for in, sum := range tests {
+		if found := xxh32([]byte(in), 0); found != sum {
+			t.Errorf("xxh32(%q): expected %#x, found %#x\n", in, sum, found)
+		}
+	}
+}
+
+// Encode an LZ4 sequence of the literals 'lits' followed by a copy of
+// 'n' bytes from 'offset' bytes back, or just the literals if 'n' is zero
+func lz4Sequence(lits string, offset, n int) []byte {
+	// Lengths of 15 or more continue in the following bytes
+	var ext []byte
+	nibble := func(l int) byte {
+		if l < 15 {
+			return byte(l)
+		}
+		for l -= 15; l >= 255; l -= 255 {
+			ext = append(ext, 255)
+		}
+		ext = append(ext, byte(l))
+		return 15
+	}
+
+	token := nibble(len(lits)) << 4
+	seq := append(append([]byte{0}, ext...), lits...)
+	if n > 0 {
+		ext = nil
+		token |= nibble(n - 4)
+		seq = append(seq, byte(offset), byte(offset>>8))
+		seq = append(seq, ext...)
+	}
+	seq[0] = token
+	return seq
+}
+
+// Wrap the LZ4 'blocks' that decompress to 'content' in a frame
+func lz4Frame(content string, blocks ...[]byte) []byte {
+	desc := []byte{0x64, 0x40}
+	frame := append([]byte{0x04, 0x22, 0x4d, 0x18}, desc...)
+	frame = append(frame, byte(xxh32(desc, 0)>>8))
+	for _, block := range blocks {
+		n := len(block)
+		frame = append(frame, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+		frame = append(frame, block...)
+	}
+	sum := xxh32([]byte(content), 0)
+	return append(frame, 0, 0, 0, 0, byte(sum), byte(sum>>8), byte(sum>>16), byte(sum>>24))
+}
+
+func TestLZ4(t *testing.T) {
+	src := ".TH AB 1\n.SH NAME\nab \\- abababab\n.SH OPTIONS\n.TP\n\\-q\nbe quiet\n"
+	prefix := ".TH AB 1\n.SH NAME\nab \\- ab"
+	block := append(lz4Sequence(prefix, 2, 6), lz4Sequence(src[len(prefix)+6:], 0, 0)...)
+	frame := lz4Frame(src, block)
+	if comp := DetectFormat(frame); comp != LZ4 {
+		t.Fatalf("DetectFormat: expected lz4, found %v\n", comp)
+	}
+
+	rdr, err := decompress(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != src {
+		t.Errorf("decompress: expected %q, found %q\n", src, data)
+	}
+
+	// Directory scans take in pages by their .lz4 suffix
+	pages, errs := ParseDir(writeTree(t, map[string]string{"man3/ab.3.lz4": string(frame)}), 1)
+	if len(pages) != 1 || len(errs) != 0 {
+		t.Fatalf("ParseDir: expected 1 page, found %d and %v\n", len(pages), errs)
+	}
+	if pages[0].Name != "ab" || pages[0].FileSection != "3" || len(pages[0].Opts) != 1 {
+		t.Errorf("ParseDir: expected ab in section 3, found '%s' '%s' %v\n",
+			pages[0].Name, pages[0].FileSection, pages[0].Opts)
+	}
+
+	frame[len(frame)-1] ^= 0xff
+	if _, err := decompress(bytes.NewReader(frame)); err == nil {
+		t.Errorf("decompress: expected a checksum error\n")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// copyright - Parsing of the copyright and license notice of a page.
+package goman
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Normalize the blanks of each line of 'text' while keeping the lines, and
+// separate paragraphs by a single blank line.
+func joinLines(text string) string {
+	var paras []string
+	for _, para := range strings.Split(text, "\n\n") {
+		var lines []string
+		for _, line := range strings.Split(para, "\n") {
+			if line = strings.Join(strings.Fields(line), " "); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			paras = append(paras, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// Return the plain text of the section 'sectname' with the line structure it
+// is formatted with, and whether the section exists.  Filled text is joined
+// up to each explicit break, while preformatted blocks keep their lines.
+func (m *ManPage) sectionLines(sectname string) (string, bool) {
+	var lines []string
+	var ok bool
+	switch m.Format {
+	case "mdoc":
+		lines, ok = m.mdocSection(sectname)
+	case "cat":
+		// The page is already formatted so its lines are kept as they are
+		text := ""
+		for _, line := range strings.Split(m.data, "\n") {
+			line = strings.TrimRight(line, " \t")
+			if cat_heading_re.MatchString(line) {
+				if ok {
+					break
+				}
+				ok = line == sectname
+			} else if ok {
+				text += line + "\n"
+			}
+		}
+		return joinLines(text), ok
+	default:
+		var data string
+		data, ok = m.sectionData(regexp.QuoteMeta(sectname))
+		lines = strings.Split(data, "\n")
+	}
+	if !ok {
+		return "", false
+	}
+
+	text, end := "", ""
+	for _, line := range lines {
+		name := macroName(line)
+		switch {
+		case isComment(line):
+		case end != "" && strings.HasPrefix(line, ".") && name == end:
+			text, end = text+"\n", ""
+		case end != "" && m.Format == "mdoc" && strings.HasPrefix(line, "."):
+			text += "\n" + mdocText(line, m.Name)
+		case end != "":
+			text += "\n" + StripRoff(line)
+		case strings.TrimSpace(line) == "" || name == "Pp":
+			text += "\n\n"
+		case name == "br":
+			text += "\n"
+		case strings.HasPrefix(line, ".") && pre_macros[name] != "":
+			text, end = text+"\n", pre_macros[name]
+		case m.Format == "mdoc" && name == "Bd" && isMdocLiteral(line):
+			text, end = text+"\n", "Ed"
+		case m.Format == "mdoc":
+			text += " " + mdocText(line, m.Name)
+		case strings.HasPrefix(line, "."):
+			// Paragraphs are separated by a blank line
+			if hasText, para := paragraph_macros[name]; para {
+				text += "\n\n"
+				if !hasText {
+					continue
+				}
+			}
+			text += " " + StripRoff(line)
+		default:
+			text += " " + StripRoff(line)
+		}
+	}
+	return joinLines(text), true
+}
+
+// Parse the copyright and license notice from the COPYRIGHT section, keeping
+// its lines as they are often laid out by hand.
+func (m *ManPage) parseCopyright() {
+	aliases, ok := SectionAliases["COPYRIGHT"]
+	if !ok {
+		aliases = []string{"COPYRIGHT"}
+	}
+	for _, alias := range aliases {
+		if text, ok := m.sectionLines(alias); ok {
+			m.Copyright = text
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// dir - Parsing of all of the man pages in a directory tree.
+package goman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+)
+
+var manfile_re = regexp.MustCompile(`\.[0-9n][a-z]*$`)
+
+// Report whether the file name 'name' looks like a man page, e.g. ls.1 or
+// printf.3p.gz, whichever way it is compressed
+func isManFile(name string) bool {
+	return manfile_re.MatchString(stripCompression(name))
+}
+
+// Return the paths of the man pages under 'dir', in lexical order
+func findManFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && isManFile(info.Name()) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// Parse the files 'paths' with 'parse' using up to 'concurrency' workers, or
+// one per CPU if 'concurrency' is not positive.  The pages and errors are
+// returned by index into 'paths'.
+func parseFiles(paths []string, concurrency int, parse func(string) (*ManPage, error)) ([]*ManPage, []error) {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	pages := make([]*ManPage, len(paths))
+	errs := make([]error, len(paths))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				man, err := parse(paths[idx])
+				if err != nil {
+					errs[idx] = fmt.Errorf("%s: %w", paths[idx], err)
+				}
+				pages[idx] = man
+			}
+		}()
+	}
+	for idx := range paths {
+		work <- idx
+	}
+	close(work)
+	wg.Wait()
+	return pages, errs
+}
+
+// ParseDir parses every man page found under 'dir' using up to 'concurrency'
+// workers, or one per CPU if 'concurrency' is not positive.  Pages that fail
+// to parse do not stop the others; their errors are returned alongside the
+// pages that were parsed, both in lexical order of path.
+func ParseDir(dir string, concurrency int) ([]*ManPage, []error) {
+	paths, err := findManFiles(dir)
+	if err != nil {
+		return nil, []error{fmt.Errorf("error walking %s: %w", dir, err)}
+	}
+	pages, errs := parseFiles(paths, concurrency, func(path string) (*ManPage, error) {
+		return NewManPage(path)
+	})
+
+	var mans []*ManPage
+	var failed []error
+	for idx := range paths {
+		if errs[idx] != nil {
+			failed = append(failed, errs[idx])
+		} else {
+			mans = append(mans, pages[idx])
+		}
+	}
+	return mans, failed
+}
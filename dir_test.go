@@ -0,0 +1,84 @@
+package goman
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDir(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"man1/a.1":      ".TH A 1\n.SH NAME\na \\- first\n",
+		"man1/b.1":      ".TH B 1\n.SH NAME\nb \\- second\n",
+		"man3/c.3":      ".TH C 3\n.SH NAME\nc \\- third\n",
+		"man1/broken.1": ".so man1/missing.1\n",
+		"man1/README":   "not a man page\n",
+	})
+
+	pages, errs := ParseDir(root, 2)
+	if len(errs) != 1 {
+		t.Errorf("ParseDir: expected 1 error, found %v\n", errs)
+	}
+	var names []string
+	for _, man := range pages {
+		names = append(names, man.Name)
+	}
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" {
+		t.Errorf("ParseDir: expected [a b c], found %v\n", names)
+	}
+}
+
+func TestParseDirCompressed(t *testing.T) {
+	pages := make(map[string]string)
+	for path, fixture := range map[string]string{
+		"man1/foobar.1.bz2": "./test.1.bz2",
+		"man3/strdup.3.bz2": "./strdup.3.bz2",
+	} {
+		data, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages[path] = string(data)
+	}
+
+	mans, errs := ParseDir(writeTree(t, pages), 2)
+	if len(mans) != 2 || len(errs) != 0 {
+		t.Fatalf("ParseDir: expected 2 pages, found %d and %v\n", len(mans), errs)
+	}
+	if mans[0].Name != "foobar" || mans[0].FileSection != "1" {
+		t.Errorf("ParseDir: expected foobar in section 1, found '%s' '%s'\n",
+			mans[0].Name, mans[0].FileSection)
+	}
+	if mans[1].FileSection != "3" || len(mans[1].Prototypes) != 3 {
+		t.Errorf("ParseDir: expected the prototypes of a section 3 page, found '%s' %v\n",
+			mans[1].FileSection, mans[1].Prototypes)
+	}
+}
+
+func TestParseDirStats(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"man1/a.1":      ".TH A 1\n.SH NAME\na \\- first\n",
+		"man1/b.1":      ".TH B 1\n.SH NAME\nb \\- second\n.SH EXAMPLES\n.nf\nb\n.XY\n",
+		"man1/c.1":      ".TH C 1\n.SH DESCRIPTION\nno name\n",
+		"man1/broken.1": ".so man1/missing.1\n",
+		"man1/d.1":      ".TH D 1\n.SH NAME\nd \\- joined \\\n.XY\n",
+	})
+
+	// The mistakes counted are those strict parsing rejects
+	if _, err := NewManPage(filepath.Join(root, "man1/d.1"), WithStrict()); err == nil {
+		t.Errorf("NewManPage: expected an unknown macro error for d.1\n")
+	}
+
+	pages, errs, stats := ParseDirStats(root, 2)
+	if len(pages) != 4 || len(errs) != 1 {
+		t.Fatalf("ParseDirStats: expected 4 pages and 1 error, found %d and %v\n", len(pages), errs)
+	}
+	if stats.Parsed != 4 || stats.Failed != 1 || stats.Warned != 3 {
+		t.Errorf("ParseDirStats: expected 4 parsed, 1 failed and 3 warned, found %+v\n", stats)
+	}
+	warnings := map[WarningKind]int{WarnMissingName: 1, WarnUnbalancedBlock: 1, WarnUnknownMacro: 2}
+	if !reflect.DeepEqual(stats.Warnings, warnings) {
+		t.Errorf("ParseDirStats: expected %v, found %v\n", warnings, stats.Warnings)
+	}
+}
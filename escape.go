@@ -0,0 +1,94 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// escape - Translation of roff escape sequences into plain text.
+package goman
+
+import (
+	"strings"
+)
+
+// Special characters, named by the \(xx and \[xx] escapes
+var special_chars = map[string]string{
+	"aq": "'", "bu": "•", "ci": "○", "co": "©", "dq": "\"",
+	"em": "—", "en": "–", "ga": "`", "ha": "^", "hy": "-",
+	"lq": "“", "mi": "-", "oq": "‘", "cq": "’", "rg": "®",
+	"rq": "”", "rs": `\`, "ti": "~", "tm": "™", "<=": "≤",
+	">=": "≥", "->": "→", "<-": "←", "mu": "×", "de": "°",
+}
+
+// Strings commonly defined by pod2man, named by the \*(xx and \*[xx] escapes
+var pod_strings = map[string]string{
+	"--": "--", "Aq": "'", "C+": "C++", "C`": "\"", "C'": "\"",
+	"L\"": "\"", "R\"": "\"", "R": "®", "Tm": "™", "PI": "π",
+}
+
+// Return the length of the name following an escape such as \f or \(,
+// which is either a single character, "(xx" or "[name]".
+func escapeNameLen(s string) int {
+	switch {
+	case s == "":
+		return 0
+	case s[0] == '(':
+		if len(s) < 3 {
+			return len(s)
+		}
+		return 3
+	case s[0] == '[':
+		if end := strings.IndexByte(s, ']'); end != -1 {
+			return end + 1
+		}
+		return len(s)
+	}
+	return 1
+}
+
+// Replace the roff escape sequences in 'str' with the text they stand for.
+// Font changes, zero-width characters and undefined strings are dropped, and
+// unrecognized escapes are left as is.
+func stripEscapes(str string) string {
+	if !strings.Contains(str, `\`) {
+		return str
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(str); i++ {
+		if str[i] != '\\' || i+1 == len(str) {
+			b.WriteByte(str[i])
+			continue
+		}
+
+		i++
+		switch str[i] {
+		case 'f':
+			i += escapeNameLen(str[i+1:])
+		case '-':
+			b.WriteByte('-')
+		case 'e', '\\':
+			b.WriteByte('\\')
+		case '&', ')', '%', ':', '|', '^', 'c':
+			// Zero-width and thin-space escapes print nothing
+		case ' ', '~':
+			// Unpaddable and non-breaking spaces are plain spaces in text
+			b.WriteByte(' ')
+		case '*':
+			n := escapeNameLen(str[i+1:])
+			b.WriteString(pod_strings[strings.Trim(str[i+1:i+1+n], "([]")])
+			i += n
+		case '(', '[':
+			n := escapeNameLen(str[i:])
+			name := strings.Trim(str[i:i+n], "([]")
+			if ch, ok := special_chars[name]; ok {
+				b.WriteString(ch)
+			} else {
+				b.WriteString(`\` + str[i:i+n])
+			}
+			i += n - 1
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(str[i])
+		}
+	}
+	return b.String()
+}
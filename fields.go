@@ -0,0 +1,43 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// fields - Selection of the fields of a man page to parse.
+package goman
+
+// Field selects the fields of ManPage filled in by parsing, for callers such
+// as search indexers that need only a few of them.
+type Field uint
+
+const (
+	FieldName        Field = 1 << iota // Name and Summary
+	FieldDesc                          // Desc
+	FieldSynopsis                      // Synopsis
+	FieldOptions                       // Opts
+	FieldExamples                      // Examples
+	FieldBugs                          // Bugs
+	FieldNotes                         // Notes
+	FieldStandards                     // Standards
+	FieldCopyright                     // Copyright
+	FieldDiagnostics                   // Diagnostics
+	FieldSubcommands                   // Subcommands
+	FieldLibrary                       // Includes, Prototypes and ReturnValue
+	FieldKeywords                      // Keywords
+)
+
+// WithFields parses only the given fields, skipping the parsers of the rest.
+// The NAME section and the page header are always parsed, as is the format
+// of the page, since the other fields build on them.
+func WithFields(fields ...Field) ParseOption {
+	return func(m *ManPage) {
+		for _, f := range fields {
+			m.fields |= f
+		}
+	}
+}
+
+// Report whether the field 'f' is to be parsed, as all are unless
+// WithFields selected some
+func (m *ManPage) wants(f Field) bool {
+	return m.fields == 0 || m.fields&f != 0
+}
@@ -0,0 +1,29 @@
+package goman
+
+import (
+	"testing"
+)
+
+// Feed arbitrary pages through the parser and renderers, which must never
+// panic however malformed the page
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		mdoc_page, examples_page, library_page, pod_page, diagnostics_page, cat_page,
+		".SH OPTIONS\n.TP\n", ".SH\n.IP\n.B\n", ".TP", ".nf\n.SH NAME\n", ".ig\n",
+		".SH OPTIONS\n.B \\-\n.BR \\-\\-x =\n", "\\", "\\f", "\\(", "\\*(", ".\n'\n",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		man, err := NewManPageFromBytes(data)
+		if err != nil {
+			return
+		}
+		_ = man.String()
+		man.ToHTML()
+		man.ToMarkdown()
+		man.Render(ANSI, RenderOptions{Width: 20})
+		man.SectionNames()
+		man.UsageLine()
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// generate - Generation of man pages from a description of a program.
+package goman
+
+import (
+	"strings"
+)
+
+// Escape the backslashes of 'text', and the lines roff would otherwise read
+// as requests, so that it reads back as written
+func roffEscape(text string) string {
+	lines := strings.Split(strings.Replace(text, `\`, `\e`, -1), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Escape the flags 'flags' of an option, writing their dashes as \- so that
+// they are not hyphenated
+func roffFlags(flags string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(flags)
+}
+
+// Return the summary of the NAME line for the description 'desc': its first
+// sentence, without the period ending it
+func generatedSummary(desc string) string {
+	para := strings.Join(strings.Fields(strings.Split(desc, "\n\n")[0]), " ")
+	if end := strings.Index(para, ". "); end != -1 {
+		para = para[:end]
+	}
+	return strings.TrimSuffix(para, ".")
+}
+
+// Write the paragraphs of 'text' separated by the request 'sep'
+func writeRoffParas(b *strings.Builder, text, sep string) {
+	for i, para := range strings.Split(text, "\n\n") {
+		if i > 0 {
+			b.WriteString(sep + "\n")
+		}
+		b.WriteString(roffEscape(para) + "\n")
+	}
+}
+
+// GenerateManPage returns the -man roff source of a page for the program
+// 'name' in manual section 'section', documenting the given options.  The
+// NAME line summarizes the program by the first sentence of 'desc'.  The
+// result parses back into an equivalent ManPage.
+func GenerateManPage(name, section string, opts []Opt, synopsis, desc string) string {
+	var b strings.Builder
+	b.WriteString(".TH " + strings.ToUpper(name) + " " + section + "\n")
+	b.WriteString(".SH NAME\n" + roffEscape(name))
+	if summary := generatedSummary(desc); summary != "" {
+		b.WriteString(` \- ` + roffEscape(summary))
+	}
+	b.WriteString("\n")
+
+	if synopsis != "" {
+		b.WriteString(".SH SYNOPSIS\n")
+		writeRoffParas(&b, synopsis, ".PP")
+	}
+	if desc != "" {
+		b.WriteString(".SH DESCRIPTION\n")
+		writeRoffParas(&b, desc, ".PP")
+	}
+	if len(opts) > 0 {
+		b.WriteString(".SH OPTIONS\n")
+		for _, o := range opts {
+			b.WriteString(".TP\n.B " + roffFlags(o.flags()) + "\n")
+			if o.Desc != "" {
+				writeRoffParas(&b, o.Desc, ".sp")
+			}
+		}
+	}
+	return b.String()
+}
@@ -6,39 +6,148 @@
 package goman
 
 import (
-	"compress/gzip"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 )
 
+// An error message documented in the DIAGNOSTICS section, and its meaning.
+type Diagnostic struct {
+	Message string
+	Meaning string
+}
+
 // An option for the program that the man page describes.
 // Often these are represented in the OPTIONS or SWITCHES section of a man page,
 // and usually are prefixed with a '-' character.
+// 'Arg' is the argument the flag takes, if any, e.g. "WHEN" for
+// "--color[=WHEN]" or "<file>" for "-o <file>", and 'OptionalArg' is set when
+// it may be left out.
+// 'Synonyms' holds any alternate spellings of the flag, such as the long form
+// of a short option.
+// 'Deprecated' is set for options the page marks as deprecated or obsolete,
+// and 'Replacement' names the option to use instead when the page says so.
+// 'Raw' is the roff source the option was parsed from, as written.
+// 'InSynopsis' is set for options whose flag the SYNOPSIS mentions, when the
+// page is parsed WithMergeSynopsisOptions.
+// 'Children' holds the sub-options documented by a list nested within the
+// option's description with .RS, such as the suboptions of mount(8)'s -o.
 type Opt struct {
-	Name string
-	Desc string
+	Name        string
+	Arg         string
+	OptionalArg bool
+	Desc        string
+	Synonyms    []string
+	Deprecated  bool
+	Replacement string
+	InSynopsis  bool
+	Raw         string
+	Children    []Opt
 }
 
 // ManPage represents the relevant fields of a man page.
+// 'Summary' is the one-line description from the NAME section, as shown by
+// whatis(1).
+// 'Name' is the command or function named by the NAME section, e.g. "ls".
+// 'Title', 'SectionNumber', 'Date', 'Source' and 'Manual' come from the page
+// header, while 'FileSection' is the section suffix of the file name.  The
+// header's 'Title' is kept as written, often in upper case, e.g. "LS", and
+// need not match 'Name'.
+// 'Version' is the release the page documents, from its VERSION section or
+// else the version in the header's source, e.g. "9.1" for "GNU coreutils 9.1".
+// 'Redirect' is the target of a page that is just a .so redirect to another
+// page, as written.
+// 'Locale' names the language of a translated page, as given by its
+// man/<locale>/manN directory, and is empty for untranslated pages.
 // 'Opts' is a list of options provided by the man page.
+// 'Format' is how the page was interpreted: the roff dialect it is written
+// in, "man" or "mdoc", "cat" for an already formatted page, or "unknown" when
+// none of them were recognized and only the file name was parsed.
+// 'Examples' holds the EXAMPLES section with the layout of example blocks
+// preserved.
+// 'Bugs' holds the known issues from the BUGS or CAVEATS section.
+// 'Notes' holds the NOTES or IMPLEMENTATION NOTES section.
+// 'Subcommands' lists the verbs of programs such as git(1), from the COMMANDS
+// or SUBCOMMANDS section.
+// 'Copyright' holds the copyright and license notice from the COPYRIGHT or
+// LICENSE section, line by line.
+// 'Diagnostics' lists the error messages explained by the DIAGNOSTICS section.
+// 'Standards' lists the standards the page conforms to, from its STANDARDS or
+// CONFORMING TO section.
+// 'Keywords' lists the topical keywords of the KEYWORDS section, where a
+// page has one.
+// 'Warnings' notes authoring mistakes worked around while parsing, such as a
+// preformatted block that is never closed.
+// 'InternalRefs' names the sections an mdoc page refers to with .Sx.
+// 'Includes' and 'Prototypes' describe the C interface of library pages, and
+// 'ReturnValue' holds the RETURN VALUE section describing their results.
 type ManPage struct {
-	Name     string
-	Path     string
-	Desc     string
-	Synopsis string
-	data     string
-	Opts     []Opt
+	Name          string
+	Summary       string
+	Path          string
+	Redirect      string
+	Desc          string
+	Synopsis      string
+	Format        string
+	Examples      string
+	Bugs          string
+	Notes         string
+	Copyright     string
+	Title         string
+	SectionNumber string
+	FileSection   string
+	Locale        string
+	Date          string
+	Source        string
+	Manual        string
+	Version       string
+	InternalRefs  []string
+	Includes      []string
+	Prototypes    []Prototype
+	ReturnValue   string
+	Subcommands   []Subcommand
+	Diagnostics   []Diagnostic
+	Standards     []string
+	Keywords      []string
+	Warnings      []string
+	data          string
+	Opts          []Opt
+
+	// Set by WithKeepFormatting, WithStrict, WithIncludeResolution,
+	// WithMaxIncludeDepth, WithFields and WithMergeSynopsisOptions
+	keepFormatting bool
+	strict         bool
+	mergeSynopsis  bool
+	includes       IncludeResolution
+	includeDepth   int
+	fields         Field
+
+	// The roff source as given, before it was normalized into 'data', and
+	// the authoring mistakes found while parsing it
+	source   string
+	mistakes []mistake
 }
 
-type parse_error struct {
+// ParseError reports a man page that could not be parsed.  'Line' is the
+// line of the roff source at fault, or zero when the error concerns the page
+// as a whole.
+type ParseError struct {
 	errmsg string
+	Line   int
 }
 
 type macro struct {
 	loc   []int
+	name  string
 	mtype macro_type
 }
 
@@ -55,24 +164,56 @@ const (
 
 var macro_types = map[string]macro_type{
 	"B":  b_macro,
+	"BI": b_macro,
+	"BR": b_macro,
 	"IP": ip_macro,
 	"PP": pp_macro,
 	"SH": sh_macro,
 	"TP": tp_macro,
 }
 
-func (pe *parse_error) Error() string {
+// Macros that continue the body of an option rather than ending it, and
+// whether they start a new paragraph
+var continuation_macros = map[string]bool{
+	"LP": true,
+	"P":  true,
+	"PP": true,
+	"RE": false,
+	"RS": false,
+	"br": false,
+	"sp": true,
+}
+
+func (pe *ParseError) Error() string {
+	if pe.Line > 0 {
+		return fmt.Sprintf("line %d: %s", pe.Line, pe.errmsg)
+	}
 	return pe.errmsg
 }
 
+// Regular expressions are compiled once and are safe for concurrent use
+var macro_re = regexp.MustCompilePOSIX(`^\.[ \t]*[A-Z]+([ \t]|$)`)
+var stripmacros_re = regexp.MustCompilePOSIX(`^\.[ \t]*[A-Z]+[ \t]*`)
+
+// Normalize a macro token, with or without its leading '.' and surrounding
+// blanks, and return the name as written.
+func macroToken(token string) string {
+	token = strings.TrimSpace(token)
+	return strings.TrimSpace(strings.TrimPrefix(token, "."))
+}
+
+// Return the type of the macro 'token', ignoring case and surrounding
+// blanks.  Macros without a type of their own resolve to zero.
+func lookupMacro(token string) macro_type {
+	return macro_types[strings.ToUpper(macroToken(token))]
+}
+
 // Given an offset return the next roff macro
 func (man *ManPage) nextmacroOffset(offset int) *macro {
-	re := regexp.MustCompilePOSIX(`^\.[A-Z]+ `)
-	if idx := re.FindStringIndex(man.data[offset:]); idx != nil {
+	if idx := macro_re.FindStringIndex(man.data[offset:]); idx != nil {
 		index := []int{offset + idx[0], offset + idx[1]}
-		str := man.data[index[0]+1 : index[1]-1]
-		mt := macro_type(macro_types[str])
-		return &macro{loc: index, mtype: mt}
+		str := macroToken(man.data[index[0]:index[1]])
+		return &macro{loc: index, name: str, mtype: lookupMacro(str)}
 	}
 	return nil
 }
@@ -82,153 +223,1521 @@ func (man *ManPage) nextmacro(macro *macro) *macro {
 	return man.nextmacroOffset(macro.loc[1])
 }
 
-// Find the next roff section named 'name'
-func (man *ManPage) findSection(name string) (int, *parse_error) {
-	re := regexp.MustCompilePOSIX(`^\.SH *` + name)
+// Find the roff section named 'name', which may be quoted as pod2man does.
+// 'start' and 'end' span its heading, so the body of the section starts at
+// 'end'.
+func (man *ManPage) findSection(name string) (start, end int, err error) {
+	re := regexp.MustCompilePOSIX(`^\.[ \t]*SH[ \t]*"?(` + name + `)"?([ \t]|$)`)
 	if idx := re.FindStringIndex(man.data); idx != nil {
-		return idx[1], nil
+		return idx[0], idx[1], nil
 	}
-	return -1, &parse_error{"Error locating section"}
+	return -1, -1, &ParseError{errmsg: "Error locating section"}
 }
 
 // Remove roff macros from a str
 func stripmacros(str string) string {
-	re := regexp.MustCompilePOSIX(`^\.[A-Z]+ *`)
-	return re.ReplaceAllString(str, "")
-}
-
-// Return a string containing the roff section named 'sectname', or nil
-// otherwise.
-func (m *ManPage) getSection(sectname string) string {
-	data := "N/A"
-	if idx, err := m.findSection(sectname); err == nil {
-		start := idx
-		var mc *macro
-		for mc = m.nextmacroOffset(start); mc != nil; mc = m.nextmacro(mc) {
-			if mc.mtype == sh_macro {
-				break
+	return stripmacros_re.ReplaceAllString(str, "")
+}
+
+// StripRoff returns the plain text of the roff fragment 's', which need not
+// be a whole page.  Escapes are translated, the arguments of macros are kept
+// as text, and comments and requests such as .br that carry no text are
+// dropped.
+func StripRoff(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if isComment(line) {
+			continue
+		}
+		if strings.HasPrefix(line, ".") {
+			name := macroName(line)
+			if text, ok := fontText(line); ok {
+				line = text
+			} else if name == "" || name[0] >= 'a' && name[0] <= 'z' {
+				continue
+			} else {
+				line = strings.Join(roffArgs(macroArgs(line)), " ")
 			}
 		}
-		if mc == nil {
-			data = m.data[start:]
-		} else {
-			data = m.data[start:mc.loc[0]]
+		lines = append(lines, stripEscapes(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// A run of text within a section.  Preformatted blocks, such as examples,
+// keep their line structure verbatim.
+type block struct {
+	text string
+	pre  bool
+}
+
+// Layout requests that carry no text and are dropped from extracted text
+var ignored_requests = map[string]bool{
+	"IX": true,
+	"PD": true,
+	"ad": true,
+	"ce": true,
+	"hw": true,
+	"hy": true,
+	"in": true,
+	"ll": true,
+	"na": true,
+	"nh": true,
+	"ti": true,
+}
+
+// Macros that start a new paragraph, and whether their arguments are text
+var paragraph_macros = map[string]bool{
+	"HP": false,
+	"IP": true,
+	"LP": false,
+	"P":  false,
+	"PP": false,
+	"SS": true,
+	"TP": false,
+	"sp": false,
+}
+
+// Requests that start and end a preformatted block
+var pre_macros = map[string]string{
+	"EX": "EE",
+	"Vb": "Ve",
+	"nf": "fi",
+}
+
+// IgnoreUnknownRequests drops lowercase requests goman does not know about,
+// such as novel layout requests, rather than letting them end an option or
+// leak into the text.  It may be cleared before parsing to surface them.
+var IgnoreUnknownRequests = true
+
+// Report whether the request or macro 'name' carries no text and is skipped
+func isIgnored(name string) bool {
+	if ignored_requests[name] {
+		return true
+	}
+	if !IgnoreUnknownRequests || name == "" || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	_, cont := continuation_macros[name]
+	_, para := paragraph_macros[name]
+	if cont || para || pre_macros[name] != "" || name == "so" {
+		return false
+	}
+	for _, end := range pre_macros {
+		if name == end {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the text blocks of the roff section named 'sectname', and whether
+// the section exists.
+func (m *ManPage) sectionBlocks(sectname string) ([]block, bool) {
+	return m.readBlocks(sectname, m.keepFormatting)
+}
+
+// Return the text blocks of the roff section named 'sectname' as plain text,
+// even when the page keeps its formatting, for the fields derived from it.
+func (m *ManPage) cleanBlocks(sectname string) ([]block, bool) {
+	return m.readBlocks(sectname, false)
+}
+
+// Return the text blocks of the roff section named 'sectname', with their
+// escapes and macros intact if 'keep' is set.
+func (m *ManPage) readBlocks(sectname string, keep bool) ([]block, bool) {
+	data, ok := m.sectionData(sectname)
+	if !ok {
+		return nil, false
+	}
+	return roffBlocks(data, keep), true
+}
+
+// Return the roff source of the body of the section named 'sectname', and
+// whether the section exists.
+func (m *ManPage) sectionData(sectname string) (string, bool) {
+	_, idx, err := m.findSection(sectname)
+	if err != nil {
+		return "", false
+	}
+	for mc := m.nextmacroOffset(idx); mc != nil; mc = m.nextmacro(mc) {
+		if mc.mtype == sh_macro {
+			return m.data[idx:mc.loc[0]], true
+		}
+	}
+	return m.data[idx:], true
+}
+
+// Split the roff fragment 'data' into its text blocks, with their escapes and
+// macros intact if 'keep' is set.
+func roffBlocks(data string, keep bool) []block {
+	var blocks []block
+	var lines []string
+	end := ""
+	clean := func(line string) string {
+		if keep {
+			return line
+		}
+		return stripEscapes(stripmacros(line))
+	}
+	flush := func(pre bool) {
+		text := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+		if !pre && !keep {
+			text = strings.Join(strings.Fields(text), " ")
+		}
+		if text != "" {
+			blocks = append(blocks, block{text: text, pre: pre})
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(data, "\n") {
+		name := macroName(line)
+		switch {
+		case isComment(line):
+			// Comments are no part of the text, wherever they are
+		case end != "" && line != "" && line[0] == '.' && name == end:
+			flush(true)
+			end = ""
+		case end != "":
+			lines = append(lines, clean(line))
+		case strings.TrimSpace(line) == "":
+			flush(false)
+		case line[0] == '.' && (isIgnored(name) || isPreEnd(name)):
+			// A stray end of a preformatted block has nothing to end
+		case line[0] == '.' && pre_macros[name] != "":
+			flush(false)
+			end = pre_macros[name]
+		default:
+			if text, ok := paragraph_macros[name]; ok && line[0] == '.' {
+				flush(false)
+				if !text {
+					continue
+				}
+			}
+			lines = append(lines, clean(line))
+		}
+	}
+	flush(end != "")
+	return blocks
+}
+
+// Report whether 'name' ends a preformatted block
+func isPreEnd(name string) bool {
+	for _, end := range pre_macros {
+		if name == end {
+			return true
+		}
+	}
+	return false
+}
+
+// Record a warning for each preformatted block that is still open at the end
+// of its section.  Sections are extracted separately, so the block ends with
+// its section rather than swallowing the rest of the page.
+func (m *ManPage) checkPreBlocks() {
+	sect, start := "", ""
+	check := func() {
+		if start != "" {
+			m.Warnings = append(m.Warnings, fmt.Sprintf(
+				"section %q: .%s without a closing .%s", sect, start, pre_macros[start]))
+		}
+		start = ""
+	}
+	for _, line := range strings.Split(m.data, "\n") {
+		if !strings.HasPrefix(line, ".") {
+			continue
+		}
+		name := macroName(line)
+		switch {
+		case name == "SH":
+			check()
+			sect = strings.Join(roffArgs(macroArgs(line)), " ")
+		case start != "" && name == pre_macros[start]:
+			start = ""
+		case start == "" && pre_macros[name] != "":
+			start = name
+		}
+	}
+	check()
+}
+
+// Return a string containing the roff section named 'sectname', and whether
+// the section exists.  Absent sections yield an empty string.  Each paragraph
+// is joined onto a single line, and paragraphs as well as preformatted blocks
+// are separated by a blank line.
+func (m *ManPage) getSection(sectname string) (string, bool) {
+	blocks, ok := m.sectionBlocks(sectname)
+	return joinBlocks(blocks), ok
+}
+
+// Return the plain text of the roff section named 'sectname', as getSection
+// does for pages that do not keep their formatting
+func (m *ManPage) cleanSection(sectname string) (string, bool) {
+	blocks, ok := m.cleanBlocks(sectname)
+	return joinBlocks(blocks), ok
+}
+
+// Join the text of 'blocks', separating them with a blank line
+func joinBlocks(blocks []block) string {
+	var text []string
+	for _, b := range blocks {
+		text = append(text, b.text)
+	}
+	return strings.Join(text, "\n\n")
+}
+
+// Report whether 'line' is a roff comment
+func isComment(line string) bool {
+	return strings.HasPrefix(line, `.\"`) || strings.HasPrefix(line, `'\"`) ||
+		strings.HasPrefix(line, `\"`) || strings.HasPrefix(line, `.\\"`)
+}
+
+// Return the .TH header line, which may be preceded by comments, blank lines
+// and other preamble requests but always comes before the first section.
+func (m *ManPage) headerLine() string {
+	lines := strings.Split(m.data, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, ".") || isComment(line) {
+			continue
+		}
+		switch macroName(line) {
+		case "TH":
+			// The fields may wrap onto lines continued with a '\'
+			for isContinued(line) && i+1 < len(lines) {
+				i++
+				line = line[:len(line)-1] + lines[i]
+			}
+			return line
+		case "SH":
+			return ""
 		}
-		data = stripmacros(data)
 	}
-	return strings.TrimSpace(strings.ReplaceAll(data, "\n", " "))
+	return ""
+}
+
+// Report whether 'line' ends with an escaped newline, continuing it onto the
+// next line
+func isContinued(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+// Parse the .TH header fields
+func (m *ManPage) parseHeader() {
+	if line := m.headerLine(); line != "" {
+		fields := []*string{&m.Title, &m.SectionNumber, &m.Date, &m.Source, &m.Manual}
+		for i, arg := range roffArgs(macroArgs(line)) {
+			if i < len(fields) {
+				*fields[i] = stripEscapes(arg)
+			}
+		}
+	}
+}
+
+// A release number such as 9.1 or v5.30.0
+var version_re = regexp.MustCompile(`\bv?([0-9]+(\.[0-9]+)+[a-z0-9]*)\b`)
+
+// Take the version from the VERSION section, or failing that from the release
+// of the package named by the .TH source, e.g. "GNU coreutils 9.1"
+func (m *ManPage) parseVersion() {
+	var ok bool
+	if m.Version, ok = m.aliasedSection("VERSION"); ok || m.Format != "man" {
+		return
+	}
+	if match := version_re.FindStringSubmatch(m.Source); match != nil {
+		m.Version = match[1]
+	}
+}
+
+// Derive the section of the page from its file name, e.g. "3" for printf.3.gz
+func (m *ManPage) parseFileSection() {
+	base := stripCompression(filepath.Base(m.Path))
+	if ext := filepath.Ext(base); ext != "" {
+		m.FileSection = ext[1:]
+	}
+}
+
+var locale_re = regexp.MustCompile(`^[a-z]{2,3}(_[A-Z]{2})?(\.[\w-]+)?(@\w+)?$`)
+var sectdir_re = regexp.MustCompile(`^man[0-9a-z]+$`)
+
+// Derive the locale of a translated page from the directory holding its
+// section directory, e.g. "de" for /usr/share/man/de/man1/ls.1.gz.  Only
+// the man/<locale>/manN layout of translated pages names a locale.
+func (m *ManPage) parseLocale() {
+	dirs := strings.Split(filepath.ToSlash(filepath.Dir(m.Path)), "/")
+	if n := len(dirs); n >= 3 && sectdir_re.MatchString(dirs[n-1]) &&
+		dirs[n-2] != "man" && locale_re.MatchString(dirs[n-2]) && dirs[n-3] == "man" {
+		m.Locale = dirs[n-2]
+	}
+}
+
+// SectionAliases lists, for each section goman extracts, the headings that
+// may hold it in order of preference.  Callers may add headings before
+// parsing to recognize pages with unusual spellings.
+var SectionAliases = map[string][]string{
+	"BUGS":         {"BUGS", "CAVEATS"},
+	"COPYRIGHT":    {"COPYRIGHT", "LICENSE"},
+	"DESCRIPTION":  {"DESCRIPTION", "OVERVIEW", "SUMMARY"},
+	"EXAMPLES":     {"EXAMPLES", "EXAMPLE"},
+	"KEYWORDS":     {"KEYWORDS", "KEY WORDS"},
+	"NOTES":        {"NOTES", "IMPLEMENTATION NOTES"},
+	"RETURN VALUE": {"RETURN VALUE", "RETURN VALUES"},
+	"STANDARDS":    {"STANDARDS", "CONFORMING TO"},
+}
+
+// Return the text of the section 'name', trying each of its aliases in
+// turn, and whether any of them exist.
+func (m *ManPage) aliasedSection(name string) (string, bool) {
+	aliases, ok := SectionAliases[name]
+	if !ok {
+		aliases = []string{name}
+	}
+	for _, alias := range aliases {
+		var text string
+		switch m.Format {
+		case "mdoc":
+			text, ok = m.getMdocSection(alias)
+		case "cat":
+			text, ok = m.getCatSection(alias)
+		default:
+			text, ok = m.getSection(regexp.QuoteMeta(alias))
+		}
+		if ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// Return the text blocks of the man section 'name', trying each of its
+// aliases in turn, and whether any of them exist.
+func (m *ManPage) aliasedBlocks(name string) ([]block, bool) {
+	aliases, ok := SectionAliases[name]
+	if !ok {
+		aliases = []string{name}
+	}
+	for _, alias := range aliases {
+		if blocks, ok := m.sectionBlocks(regexp.QuoteMeta(alias)); ok {
+			return blocks, true
+		}
+	}
+	return nil, false
 }
 
 func (m *ManPage) parseName() {
-	name := strings.Split(m.getSection("NAME"), " ")[0]
+	sect, _ := m.cleanSection("NAME")
+	name := strings.Split(sect, " ")[0]
 	m.Name = strings.TrimRight(name, ` \,`)
+	m.Summary = nameSummary(sect)
+}
+
+// Return the one-line summary following the dash of a NAME section, or an
+// empty string if there is none.
+func nameSummary(name string) string {
+	for _, sep := range []string{` \- `, ` - `} {
+		if idx := strings.Index(name, sep); idx != -1 {
+			return strings.TrimSpace(name[idx+len(sep):])
+		}
+	}
+	return ""
 }
 
 func (m *ManPage) parseDesc() {
-	m.Desc = m.getSection("DESCRIPTION")
+	var ok bool
+	m.Desc, ok = m.aliasedSection("DESCRIPTION")
+
+	// Short pages may only have a NAME line, use its summary instead
+	if !ok {
+		m.Desc = m.Summary
+	}
 }
 
 func (m *ManPage) parseSynopsis() {
-	m.Synopsis = m.getSection("SYNOPSIS")
+	m.Synopsis, _ = m.getSection("SYNOPSIS")
 }
 
-// Parse out options from the man page
-func (m *ManPage) parseOpts() {
-	idx, err := m.findSection(`(OPTIONS|SWITCHES)`)
-	if err != nil {
-		if idx, err = m.findSection(`DESCRIPTION`); err != nil {
-			return
+// UsageLine returns the first form of the SYNOPSIS on a single line, such as
+// "ls [OPTION]... [FILE]...", or just the name of the page if it has none.
+func (m *ManPage) UsageLine() string {
+	if forms := m.SynopsisLines(); len(forms) > 0 {
+		return forms[0]
+	}
+	return m.Name
+}
+
+// SynopsisLines returns each form of the SYNOPSIS, as plain text on a single
+// line.  Forms are separated by a blank line, or are recognized by starting
+// with the name of the page again.
+func (m *ManPage) SynopsisLines() []string {
+	synopsis := m.Synopsis
+	if m.keepFormatting && m.Format == "man" {
+		synopsis, _ = m.cleanSection("SYNOPSIS")
+	}
+
+	var forms, words []string
+	flush := func() {
+		if len(words) > 0 {
+			forms = append(forms, strings.Join(words, " "))
 		}
+		words = nil
 	}
+	for _, para := range strings.Split(synopsis, "\n\n") {
+		for _, word := range strings.Fields(para) {
+			if word == m.Name {
+				flush()
+			}
+			words = append(words, word)
+		}
+		flush()
+	}
+	return forms
+}
+
+func (m *ManPage) parseBugs() {
+	m.Bugs, _ = m.aliasedSection("BUGS")
+}
+
+// Split the STANDARDS section into the standards it lists, separated by
+// commas or line breaks
+func (m *ManPage) parseStandards() {
+	text, _ := m.aliasedSection("STANDARDS")
+	split := func(r rune) bool { return r == ',' || r == '\n' }
+	for _, std := range strings.FieldsFunc(text, split) {
+		if std = strings.TrimSuffix(strings.TrimSpace(std), "."); std != "" {
+			m.Standards = append(m.Standards, std)
+		}
+	}
+}
+
+func (m *ManPage) parseNotes() {
+	m.Notes, _ = m.aliasedSection("NOTES")
+}
+
+func (m *ManPage) parseExamples() {
+	m.Examples, _ = m.aliasedSection("EXAMPLES")
+}
+
+// Split the arguments of a roff macro line, honoring double quotes.
+func roffArgs(line string) []string {
+	var args []string
+	var arg strings.Builder
+	quoted, inarg := false, false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inarg = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inarg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inarg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inarg = true
+		}
+	}
+	if inarg {
+		args = append(args, arg.String())
+	}
+	return args
+}
 
-	// We have a OPTIONS or SWITCHES section
+// Return the name of the macro on a roff 'line' without the leading '.'
+func macroName(line string) string {
+	if strings.HasPrefix(line, ".") {
+		line = "." + strings.TrimLeft(line[1:], " \t")
+	}
+	if end := strings.IndexAny(line, " \t"); end != -1 {
+		line = line[:end]
+	}
+	return strings.TrimPrefix(line, ".")
+}
+
+// Return the arguments of the macro on a roff 'line', following its name
+func macroArgs(line string) string {
+	line = strings.TrimLeft(strings.TrimPrefix(line, "."), " \t")
+	if end := strings.IndexAny(line, " \t"); end != -1 {
+		return line[end:]
+	}
+	return ""
+}
+
+// Tags that mark the items of a bulleted list
+var bullets = map[string]bool{
+	"*": true, "-": true, "o": true, "•": true, "○": true, "—": true, "–": true,
+}
+
+// Report whether the arguments of an .IP macro tag a bulleted list item
+// rather than an option
+func isBullet(args string) bool {
+	tag := roffArgs(args)
+	return len(tag) > 0 && bullets[tag[0]]
+}
+
+// Normalize the whitespace of each paragraph in 'text', keeping the blank
+// lines that separate them.
+func joinParagraphs(text string) string {
+	var paras []string
+	for _, para := range strings.Split(text, "\n\n") {
+		if para = strings.Join(strings.Fields(para), " "); para != "" {
+			paras = append(paras, para)
+		}
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// A tagged paragraph of a section, such as an .IP or .TP entry.  The
+// paragraphs of 'body' are separated by blank lines, and 'raw' is the
+// entry's roff source.  'extra' holds the further tags groff's .TQ adds to a
+// .TP entry, which share its body, and 'nested' the roff source of each block
+// of the body indented by .RS.
+type entry struct {
+	tag    string
+	extra  []string
+	body   string
+	raw    string
+	nested []string
+}
+
+// The indent argument of a paragraph macro, such as 4 or 0.5i
+var indent_re = regexp.MustCompile(`^[0-9.]+[cimnPpuv]?$`)
+
+// Font macros, and whether they alternate fonts between their arguments
+// rather than setting all of them in one
+var font_macros = map[string]bool{
+	"B": false, "I": false, "SB": false,
+	"BI": true, "BR": true, "IB": true, "IR": true, "RB": true, "RI": true,
+}
+
+// Return the text set by the font macro on 'line', and whether it is one.
+// Alternating fonts run their arguments together, as roff does.
+func fontText(line string) (string, bool) {
+	if !strings.HasPrefix(line, ".") {
+		return "", false
+	}
+	alt, ok := font_macros[macroName(line)]
+	if !ok {
+		return "", false
+	}
+	sep := " "
+	if alt {
+		sep = ""
+	}
+	return strings.Join(roffArgs(macroArgs(line)), sep), true
+}
+
+// Clean a line of text for use in an entry
+func entryText(line string) string {
+	return stripEscapes(strings.ReplaceAll(line, "\t", " "))
+}
+
+// Append a line of an entry's text to 'body', cleaned unless the page keeps
+// its formatting
+func (m *ManPage) appendBody(body, line string) string {
+	if m.keepFormatting {
+		return body + "\n" + line
+	}
+	return body + " " + entryText(line)
+}
+
+// Normalize the paragraphs of an entry's body.  Kept formatting keeps its
+// line breaks, which roff relies on.
+func (m *ManPage) bodyText(body string) string {
+	if !m.keepFormatting {
+		return joinParagraphs(body)
+	}
+	var paras []string
+	for _, para := range strings.Split(body, "\n\n") {
+		if para = strings.Trim(para, " \n"); para != "" {
+			paras = append(paras, para)
+		}
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// Read the tagged paragraph started by the macro 'mc', whose body runs until
+// the next tag or heading.  'mc' is advanced past the body so that walking
+// resumes after it.
+func (m *ManPage) readEntry(mc *macro) entry {
+	var e entry
+	pos := mc.loc[1]
+	tq, depth, comments := false, 0, 0
+	nested := 0
+	done := func() entry {
+		if depth > 0 {
+			e.nested = append(e.nested, m.data[nested:pos])
+		}
+		e.raw = strings.TrimRight(m.data[mc.loc[0]:pos], "\n")
+		mc.loc = []int{mc.loc[0], pos}
+		return e
+	}
+	// Lines are taken one at a time, as the body is seldom more than a few
+	// of the many lines left in the page
+	for i, last := 0, false; !last; i++ {
+		raw := m.data[pos:]
+		if end := strings.IndexByte(raw, '\n'); end != -1 {
+			raw = raw[:end+1]
+		} else {
+			last = true
+		}
+		line := strings.TrimSuffix(raw, "\n")
+		switch {
+		case i > 0 && isComment(line):
+			// Comment lines are skipped, even ahead of the tag of .TP
+			comments++
+		case i == 0 && mc.mtype == b_macro:
+			// The whole line is the tag, and may run on into the text
+			// it describes
+			tag, _ := fontText("." + mc.name + " " + line)
+			e.tag = entryText(tag)
+		case i == 0 && mc.mtype == ip_macro:
+			// The tag is the first argument of .IP, which may be quoted
+			// and be followed by the indent.  Anything else on the line
+			// runs on into the text.
+			args := roffArgs(line)
+			if len(args) == 0 {
+				break
+			}
+			if len(args) == 1 || len(args) == 2 && indent_re.MatchString(args[1]) ||
+				strings.HasPrefix(strings.TrimSpace(line), `"`) {
+				e.tag = entryText(args[0])
+			} else {
+				e.tag = entryText(line)
+			}
+		case i == 0:
+			// .TP takes its tag from the next line
+			if mc.mtype != tp_macro {
+				e.tag = entryText(line)
+			}
+		case i-comments == 1 && mc.mtype == tp_macro:
+			// The tag may be set in a font, otherwise tags set by a macro
+			// are walked as entries of their own
+			if tag, ok := fontText(line); ok {
+				e.tag = entryText(tag)
+			} else if line != "" && line[0] == '.' {
+				return done()
+			} else {
+				e.tag = entryText(line)
+			}
+		case tq:
+			// Like that of .TP, the tag may be set in a font
+			tag, ok := fontText(line)
+			if !ok {
+				tag = line
+			}
+			e.extra = append(e.extra, entryText(tag))
+			tq = false
+		case mc.mtype == tp_macro && e.body == "" && strings.HasPrefix(line, ".") &&
+			macroName(line) == "TQ":
+			tq = true
+		case line == "":
+			e.body += "\n\n"
+		case line[0] == '.':
+			name := macroName(line)
+			if isIgnored(name) {
+				break
+			}
+			if text, ok := fontText(line); ok && (depth > 0 || !strings.HasPrefix(stripEscapes(text), "-")) {
+				// Emphasis within the text rather than the next flag,
+				// which is no flag of the entry's own list when nested
+				if m.keepFormatting {
+					text = line
+				}
+				e.body = m.appendBody(e.body, text)
+				break
+			}
+			para, ok := continuation_macros[name]
+			if name == "IP" && len(roffArgs(macroArgs(line))) == 0 {
+				// An untagged .IP continues the indented paragraph
+				para, ok = true, true
+			}
+			switch name {
+			case "RS":
+				// An indent that is never closed nests nothing, or it
+				// would swallow the entries after it
+				if depth > 0 || indentCloses(m.data[pos+len(raw):]) {
+					if depth++; depth == 1 {
+						nested = pos + len(raw)
+					}
+				}
+			case "RE":
+				if depth--; depth == 0 {
+					e.nested = append(e.nested, m.data[nested:pos])
+				}
+			case "IP", "TP":
+				// Lists nested within the body by .RS are part of it
+				if depth > 0 {
+					para, ok = true, true
+					args := roffArgs(macroArgs(line))
+					if name == "IP" && len(args) > 0 && !isBullet(entryText(args[0])) {
+						e.body += "\n\n" + entryText(args[0])
+						para = false
+					}
+				}
+			}
+			if !ok {
+				return done()
+			}
+			if para {
+				e.body += "\n\n"
+			}
+		default:
+			e.body = m.appendBody(e.body, line)
+		}
+		pos += len(raw)
+	}
+	return done()
+}
+
+// Report whether the indent opened by .RS ahead of 'data' is closed by a
+// matching .RE before the next heading
+func indentCloses(data string) bool {
+	depth := 1
+	for data != "" {
+		line := data
+		if end := strings.IndexByte(data, '\n'); end != -1 {
+			line, data = data[:end], data[end+1:]
+		} else {
+			data = ""
+		}
+		if !strings.HasPrefix(line, ".") {
+			continue
+		}
+		switch macroName(line) {
+		case "RS":
+			depth++
+		case "RE":
+			if depth--; depth == 0 {
+				return true
+			}
+		case "SH", "SS":
+			return false
+		}
+	}
+	return false
+}
+
+// Walk the tagged paragraphs of the section whose body starts at 'idx',
+// calling 'fn' for each.  Macros other than tags and paragraph breaks end
+// the walk, unless 'loose' is set.
+func (m *ManPage) walkEntries(idx int, loose bool, fn func(mt macro_type, e entry)) {
 	for mc := m.nextmacroOffset(idx); mc != nil; mc = m.nextmacro(mc) {
 		if mc.mtype == sh_macro {
 			break
 		}
 
-		if !(mc.mtype == b_macro || mc.mtype == ip_macro) {
-			break
+		// Paragraphs within an entry's body were consumed along with it,
+		// and layout requests such as pod2man index entries are not content
+		if _, ok := continuation_macros[mc.name]; ok || isIgnored(mc.name) {
+			continue
 		}
 
-		// B or IP
-		opt := ""
-		lines := strings.Split(m.data[mc.loc[1]:], "\n")
-		for _, line := range lines {
-			if len(line) == 0 || line[0] == '.' {
-				break
+		if !(mc.mtype == b_macro || mc.mtype == ip_macro || mc.mtype == tp_macro) {
+			if loose {
+				continue
 			}
-			opt += " " + line
+			break
+		}
+		fn(mc.mtype, m.readEntry(mc))
+	}
+}
+
+// Parse out options from the man page
+func (m *ManPage) parseOpts() {
+	_, idx, err := m.findSection(`(OPTIONS|SWITCHES)`)
+	fallback := false
+	if err != nil {
+		if _, idx, err = m.findSection(`DESCRIPTION`); err != nil {
+			return
 		}
+		fallback = true
+	}
 
-		// Grab '-<optname>\n'
-		opt = strings.TrimRight(opt, " ")
-		if idx := strings.Index(opt, "-"); idx != -1 {
-			if spc := strings.IndexAny(opt[idx:], "\r "); spc != -1 {
-				spc += 1
-				opt_name := opt[idx:spc]
-				opt_desc := strings.Trim(opt[spc:], " ")
-				m.Opts = append(m.Opts, Opt{Name: opt_name, Desc: opt_desc})
+	// We have a OPTIONS or SWITCHES section, though option entries may be
+	// interspersed with prose in DESCRIPTION
+	m.Opts = append(m.Opts, m.entryOpts(idx, fallback)...)
+}
+
+// Return the options documented by the tagged paragraphs of the section
+// whose body starts at 'idx'.  With 'fallback' set, the section is not one of
+// options and only entries whose tag is a flag are taken.
+func (m *ManPage) entryOpts(idx int, fallback bool) []Opt {
+	var opts []Opt
+	var pending []string
+	pendingArg, pendingRaw := "", ""
+	m.walkEntries(idx, fallback, func(mt macro_type, e entry) {
+		if mt == ip_macro && (isBullet(e.tag) || strings.TrimSpace(e.tag) == "") {
+			return
+		}
+
+		// Outside of an OPTIONS section only tagged paragraphs whose tag is
+		// a flag count, as flags set in bold are also mentioned in prose
+		opt := strings.TrimRight(" "+e.tag+e.body, " \n")
+		tag := strings.TrimSpace(e.tag)
+		if fallback && (mt == b_macro || !isFlag(tag)) {
+			return
+		}
+
+		// BSD style options, such as those of ps(1), are bare letters
+		if !fallback && mt != b_macro && bare_flag_re.MatchString(tag) {
+			opts = append(opts, Opt{Name: tag, Desc: m.bodyText(e.body), Raw: e.raw,
+				Children: m.nestedOpts(e.nested)})
+			return
+		}
+
+		// Grab '-<optname>\n', or the '+<optname>' of the options some
+		// classic tools take
+		idx := strings.Index(opt, "-")
+		if strings.HasPrefix(tag, "+") {
+			idx = strings.Index(opt, "+")
+		}
+		if idx != -1 {
+			if flags, arg, desc := splitFlags(opt[idx:]); len(flags) > 0 {
+				// Tags added by .TQ are synonyms sharing the description
+				for _, tag := range e.extra {
+					more, extraArg, _ := splitFlags(tag)
+					flags = append(flags, more...)
+					if arg == "" {
+						arg = extraArg
+					}
+				}
+				// Synonyms may each be set on a .B line of their own
+				// ahead of the description they share
+				if mt == b_macro && strings.TrimSpace(desc) == "" {
+					pending = append(pending, flags...)
+					pendingRaw += e.raw + "\n"
+					if arg != "" {
+						pendingArg = arg
+					}
+					return
+				}
+				if arg == "" {
+					arg = pendingArg
+				}
+
+				// An argument after a blank is only told from the text by
+				// its form, and must be within the tag
+				if arg == "" && isFlag(tag) {
+					_, _, rest := splitFlags(tag)
+					if arg = placeholder(rest); arg != "" {
+						desc = strings.TrimPrefix(strings.TrimLeft(desc, " \t"), arg)
+					}
+				}
+				flags = append(pending, flags...)
+				arg, optional := splitArg(arg)
+				opts = append(opts, Opt{
+					Name:        flags[0],
+					Arg:         arg,
+					OptionalArg: optional,
+					Desc:        m.bodyText(desc),
+					Synonyms:    flags[1:],
+					Raw:         pendingRaw + e.raw,
+					Children:    m.nestedOpts(e.nested),
+				})
+				pending, pendingArg, pendingRaw = nil, "", ""
 			}
 		}
+	})
+	if len(pending) > 0 {
+		arg, optional := splitArg(pendingArg)
+		opts = append(opts, Opt{Name: pending[0], Arg: arg, OptionalArg: optional,
+			Synonyms: pending[1:], Raw: strings.TrimSuffix(pendingRaw, "\n")})
+	}
+	return opts
+}
+
+// Return the sub-options listed by the .TP entries of the roff blocks
+// 'nested' within an option's description
+func (m *ManPage) nestedOpts(nested []string) []Opt {
+	var opts []Opt
+	for _, data := range nested {
+		sub := &ManPage{data: data, keepFormatting: m.keepFormatting}
+		opts = append(opts, sub.entryOpts(0, true)...)
 	}
+	return opts
+}
+
+// Parse the error messages and their meanings listed as tagged paragraphs
+// in the DIAGNOSTICS section
+func (m *ManPage) parseDiagnostics() {
+	_, idx, err := m.findSection("DIAGNOSTICS")
+	if err != nil {
+		return
+	}
+	m.walkEntries(idx, true, func(mt macro_type, e entry) {
+		tag := strings.TrimSpace(e.tag)
+		if mt == b_macro || tag == "" || isBullet(tag) {
+			return
+		}
+		m.Diagnostics = append(m.Diagnostics, Diagnostic{
+			Message: tag,
+			Meaning: m.bodyText(e.body),
+		})
+	})
+}
+
+// Return the flags of an option as documented, e.g. "-v, --verbose"
+func (o Opt) flags() string {
+	return strings.Join(append([]string{o.Name + o.argForm()}, o.Synonyms...), ", ")
 }
 
 // Returns a string representation of an option specified in a man page.
 func (o Opt) String() string {
-	return o.Name + ": " + o.Desc
+	return o.flags() + ": " + o.Desc
+}
+
+// ToText returns the plain text rendering of the man page, as written by
+// WriteTo but with runs of blank lines outside of preformatted examples
+// collapsed to one.
+func (m *ManPage) ToText() string {
+	str, _ := m.Render(Text, default_render_opts)
+	return str
 }
 
 // Returns a string representation of a man page data structure.
 func (m *ManPage) String() string {
-	str := fmt.Sprintf(
+	var str strings.Builder
+	m.WriteTo(&str)
+	return str.String()
+}
+
+// WriteTo streams the string representation of the man page to 'w', without
+// building it in memory first.  It implements io.WriterTo.
+func (m *ManPage) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	write := func(format string, args ...interface{}) error {
+		n, err := fmt.Fprintf(w, format, args...)
+		total += int64(n)
+		return err
+	}
+
+	err := write(
 		"Name:     %s\n"+
 			"Desc:     %s\n"+
 			"Synposis: %s\n", m.Name, m.Desc, m.Synopsis)
+	if err != nil {
+		return total, err
+	}
 
 	if len(m.Opts) > 0 {
-		str += "Options:\n"
+		if err := write("Options:\n"); err != nil {
+			return total, err
+		}
 		for _, o := range m.Opts {
-			str += fmt.Sprintf("%v\n", o)
+			if err := write("%v\n", o); err != nil {
+				return total, err
+			}
 		}
 	}
 
-	return str
+	if m.Examples != "" {
+		if err := write("Examples:\n%s\n", m.Examples); err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
 }
 
-func (man *ManPage) parse(data string) {
-	// Remove carriage return
-	replace := strings.NewReplacer("\x0D", "")
-	man.data = replace.Replace(data)
+// Clone returns a deep copy of the man page.  The copy shares no mutable
+// state with the original, so a cached page can be handed out and modified
+// safely.
+func (m *ManPage) Clone() *ManPage {
+	c := *m
+	c.Includes = copyStrings(m.Includes)
+	c.InternalRefs = copyStrings(m.InternalRefs)
+	c.Prototypes = nil
+	for _, p := range m.Prototypes {
+		p.Params = copyStrings(p.Params)
+		c.Prototypes = append(c.Prototypes, p)
+	}
+	c.Subcommands = append([]Subcommand(nil), m.Subcommands...)
+	c.Diagnostics = append([]Diagnostic(nil), m.Diagnostics...)
+	c.Standards = copyStrings(m.Standards)
+	c.Keywords = copyStrings(m.Keywords)
+	c.Warnings = copyStrings(m.Warnings)
+	c.Opts = cloneOpts(m.Opts)
+	c.mistakes = append([]mistake(nil), m.mistakes...)
+	return &c
+}
+
+// Equal reports whether two man pages parsed to the same fields.  Options
+// are compared regardless of their order, empty lists are equal whether nil
+// or not, and the roff source the pages were parsed from is not compared.
+func (m *ManPage) Equal(other *ManPage) bool {
+	if m == nil || other == nil {
+		return m == other
+	}
+	a, b := m.Clone(), other.Clone()
+	for _, c := range []*ManPage{a, b} {
+		c.data, c.keepFormatting, c.strict, c.includes = "", false, false, IncludeEager
+		c.includeDepth, c.fields, c.mergeSynopsis, c.mistakes = 0, 0, false, nil
+		c.source = ""
 
-	// Parse all of the interesting parts
-	man.parseName()
-	man.parseDesc()
-	man.parseSynopsis()
-	man.parseOpts()
+		// Empty lists are equal however they were built
+		strs := []*[]string{&c.Includes, &c.InternalRefs, &c.Standards, &c.Keywords, &c.Warnings}
+		for _, strs := range strs {
+			if len(*strs) == 0 {
+				*strs = nil
+			}
+		}
+		c.Opts = normalizeOpts(c.Opts)
+		if len(c.Prototypes) == 0 {
+			c.Prototypes = nil
+		}
+		if len(c.Subcommands) == 0 {
+			c.Subcommands = nil
+		}
+		if len(c.Diagnostics) == 0 {
+			c.Diagnostics = nil
+		}
+	}
+	return reflect.DeepEqual(a, b)
 }
 
-// Instantiate and parse a man page given a gziped man page path.
-func NewManPage(filename string) (*ManPage, error) {
-	man := ManPage{Path: filename}
+// Sort 'opts' by name and make their empty lists nil, recursing into their
+// children, so that options compare equal however they were built
+func normalizeOpts(opts []Opt) []Opt {
+	if len(opts) == 0 {
+		return nil
+	}
+	sort.Stable(ByName(opts))
+	for i := range opts {
+		if len(opts[i].Synonyms) == 0 {
+			opts[i].Synonyms = nil
+		}
+		opts[i].Children = normalizeOpts(opts[i].Children)
+	}
+	return opts
+}
+
+// Return a copy of 'strs', preserving whether it is nil
+func copyStrings(strs []string) []string {
+	if strs == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(strs)), strs...)
+}
+
+// Return a deep copy of 'opts'
+func cloneOpts(opts []Opt) []Opt {
+	if opts == nil {
+		return nil
+	}
+	c := make([]Opt, len(opts))
+	for i, o := range opts {
+		o.Synonyms = copyStrings(o.Synonyms)
+		o.Children = cloneOpts(o.Children)
+		c[i] = o
+	}
+	return c
+}
+
+// RoffSource wraps a man page so that text based encoders, such as
+// encoding/json and encoding/xml, encode it as the roff source it was parsed
+// from rather than as an object of its fields.  It implements
+// encoding.TextMarshaler and encoding.TextUnmarshaler.
+type RoffSource struct {
+	Page *ManPage
+}
+
+// MarshalText returns the roff source the page was parsed from, as it was
+// given, which UnmarshalText accepts to rebuild an equivalent ManPage.
+func (r RoffSource) MarshalText() ([]byte, error) {
+	if r.Page == nil {
+		return nil, nil
+	}
+	return []byte(r.Page.source), nil
+}
+
+// UnmarshalText parses the roff source in 'text' into the wrapped page,
+// replacing any previously parsed content, or into a new page when there is
+// none.
+func (r *RoffSource) UnmarshalText(text []byte) error {
+	if r.Page == nil {
+		r.Page = &ManPage{}
+	}
+	m := r.Page
+	*m = ManPage{Path: m.Path, keepFormatting: m.keepFormatting}
+	m.parse(string(text))
+	return nil
+}
 
+// The fields of a ManPage, without its methods, so that gob and encoding/json
+// encode them rather than calling GobEncode or MarshalJSON again
+type gob_fields ManPage
+
+// MarshalJSON encodes the fields of the man page as an object, along with
+// 'Sections' listing the name and body of each of its sections in the order
+// they appear in the source.  It implements json.Marshaler.
+func (m *ManPage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		*gob_fields
+		Sections []Section
+	}{(*gob_fields)(m), m.OrderedSections()})
+}
+
+// The gob form of a ManPage, which includes its roff source
+type gob_page struct {
+	Fields         *gob_fields
+	Data           string
+	Source         string
+	KeepFormatting bool
+}
+
+// GobEncode encodes the parsed fields of the man page along with its roff
+// source, so that the decoded page needs no parsing.  It implements
+// gob.GobEncoder.
+func (m *ManPage) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(gob_page{(*gob_fields)(m), m.data, m.source, m.keepFormatting})
+	return buf.Bytes(), err
+}
+
+// GobDecode decodes a man page written by GobEncode.  It implements
+// gob.GobDecoder.
+func (m *ManPage) GobDecode(data []byte) error {
+	*m = ManPage{}
+	page := gob_page{Fields: (*gob_fields)(m)}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&page); err != nil {
+		return err
+	}
+	m.data, m.source, m.keepFormatting = page.Data, page.Source, page.KeepFormatting
+	return nil
+}
+
+// Return the name of the request ending the block, such as that of .ig, that
+// 'line' starts, given by its argument 'n', or "." when that is missing
+func blockEnd(line string, n int) string {
+	args := macroArgs(line)
+	if idx := strings.Index(args, `\"`); idx != -1 {
+		args = args[:idx]
+	}
+	if fields := roffArgs(args); n < len(fields) {
+		return fields[n]
+	}
+	return "."
+}
+
+// Remove the blocks of 'data' ignored with the .ig request, which often hold
+// license preambles.  A block ends at a ".." line, or at the request named by
+// the argument of .ig.
+func stripIgnored(data string) string {
+	if !strings.Contains(data, ".ig") {
+		return data
+	}
+	var lines []string
+	end := ""
+	for _, raw := range strings.SplitAfter(data, "\n") {
+		line := strings.TrimSuffix(raw, "\n")
+		switch {
+		case end != "":
+			if strings.TrimRight(line, " \t") == "."+end {
+				end = ""
+			}
+		case strings.HasPrefix(line, ".") && macroName(line) == "ig":
+			end = blockEnd(line, 0)
+		default:
+			lines = append(lines, raw)
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// Macros whose quoted first argument follows their name without a blank
+var unspaced_args_re = regexp.MustCompile(`(?m)^(\.[ \t]*[A-Za-z]+)"`)
+
+// Separate the name of each macro from a quoted argument run onto it, as in
+// the .SH"NAME" some generators write, so it reads as .SH "NAME" does
+func spaceMacroArgs(data string) string {
+	return unspaced_args_re.ReplaceAllString(data, `$1 "`)
+}
+
+// Join the lines of 'data' that a trailing backslash continues onto the next,
+// as roff reads them as one.  A doubled backslash is an escaped one that
+// continues nothing, comments end with their line regardless, and formatted
+// pages are plain text where a backslash is just a backslash.  The body of a
+// conditional opened by "\{\" stays on lines of its own, as conditions are
+// skipped while their bodies are read.
+func joinContinuations(data string) string {
+	if !strings.Contains(data, "\\\n") || isCat(data) {
+		return data
+	}
+	lines := strings.Split(data, "\n")
+	out := lines[:0]
+	cont := false
+	for _, line := range lines {
+		if cont {
+			out[len(out)-1] += line
+		} else {
+			out = append(out, line)
+		}
+		cont = isContinued(line) && !strings.Contains(line, `\"`) &&
+			!strings.HasSuffix(line, `\{\`)
+		if cont {
+			out[len(out)-1] = strings.TrimSuffix(out[len(out)-1], `\`)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// The fonts .ft selects by position rather than by name
+var numbered_fonts = map[string]string{"1": "R", "2": "I", "3": "B", "4": "BI"}
+
+// Return the inline escape that selects the font 'name', e.g. \fB or \f(CW
+func fontEscape(name string) string {
+	switch len(name) {
+	case 1:
+		return `\f` + name
+	case 2:
+		return `\f(` + name
+	}
+	return `\f[` + name + `]`
+}
+
+// Replace the .ft requests of 'data' with inline font escapes around each
+// line of text they set, so that the emphasis they add is kept along with
+// the rest of the formatting.  A font lasts until the next .ft, which may
+// return to the previous font with P or an empty argument.
+func inlineFontRequests(data string) string {
+	if !strings.Contains(data, ".ft") {
+		return data
+	}
+	lines := strings.Split(data, "\n")
+	out := lines[:0]
+	font, prev := "R", "R"
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, ".") && macroName(line) == "ft":
+			name := strings.TrimSpace(macroArgs(line))
+			if num, ok := numbered_fonts[name]; ok {
+				name = num
+			}
+			if name == "" || name == "P" {
+				name = prev
+			}
+			font, prev = name, font
+		case font != "R" && strings.TrimSpace(line) != "" && line[0] != '.' &&
+			line[0] != '\'' && !isComment(line):
+			out = append(out, fontEscape(font)+line+`\fR`)
+		default:
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// Font macros that set the next input line in their font when given no
+// arguments
+var next_line_fonts = map[string]bool{"B": true, "I": true, "SB": true, "SM": true}
+
+// Join the text lines that font macros without arguments apply to onto the
+// macro, so ".B" followed by "bold text" reads as ".B bold text".  Lines with
+// quotes are left as they are, since they would be split differently as
+// arguments.
+func joinFontLines(data string) string {
+	lines := strings.Split(data, "\n")
+	out := lines[:0]
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, ".") && next_line_fonts[macroName(line)] &&
+			strings.TrimSpace(macroArgs(line)) == "" && i+1 < len(lines) {
+			next := lines[i+1]
+			if strings.TrimSpace(next) != "" && next[0] != '.' && next[0] != '\'' &&
+				!strings.Contains(next, `"`) {
+				line = strings.TrimRight(line, " \t") + " " + next
+				i++
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// Macros that mark a page written with the man macros
+var man_re = regexp.MustCompilePOSIX(`^\.[ \t]*(TH|SH)([ \t]|$)`)
+
+// Return how the page 'data' is to be interpreted: "mdoc", "man", "cat" or
+// "unknown".
+func pageFormat(data string) string {
+	switch {
+	case isMdoc(data):
+		return "mdoc"
+	case man_re.MatchString(data):
+		return "man"
+	case isCat(data):
+		return "cat"
+	}
+	return "unknown"
+}
+
+// Normalize the roff source 'data' into the form the page is parsed from
+func normalize(data string) string {
+	// Normalize CRLF and lone CR line endings to LF
+	replace := strings.NewReplacer("\r\n", "\n", "\r", "\n")
+	data = spaceMacroArgs(stripIgnored(replace.Replace(data)))
+	return inlineFontRequests(joinFontLines(joinContinuations(data)))
+}
+
+func (man *ManPage) parse(data string) {
+	man.source, man.data = data, normalize(data)
+
+	man.parseFileSection()
+	man.parseLocale()
+
+	// BSD pages are written with the mdoc macros and formatted pages have
+	// no macros left, each needs its own parser
+	man.Format = pageFormat(man.data)
+	switch man.Format {
+	case "mdoc":
+		man.parseMdoc()
+	case "cat":
+		man.parseCat()
+	case "man":
+		// Parse all of the interesting parts
+		man.parseHeader()
+		man.parseVersion()
+		man.checkPreBlocks()
+		man.parseName()
+		if man.wants(FieldDesc) {
+			man.parseDesc()
+		}
+		if man.wants(FieldSynopsis) {
+			man.parseSynopsis()
+		}
+		if man.wants(FieldExamples) {
+			man.parseExamples()
+		}
+		if man.wants(FieldBugs) {
+			man.parseBugs()
+		}
+		if man.wants(FieldNotes) {
+			man.parseNotes()
+		}
+		if man.wants(FieldStandards) {
+			man.parseStandards()
+		}
+		if man.wants(FieldKeywords) {
+			man.parseKeywords()
+		}
+		if man.wants(FieldCopyright) {
+			man.parseCopyright()
+		}
+		if man.wants(FieldDiagnostics) {
+			man.parseDiagnostics()
+		}
+		if man.wants(FieldSubcommands) {
+			man.parseSubcommands()
+		}
+		if man.wants(FieldOptions) {
+			man.parseOpts()
+		}
+		if man.wants(FieldLibrary) {
+			man.parsePrototypes()
+			man.parseReturnValue()
+		}
+	}
+
+	man.dedupOpts()
+	man.markDeprecated()
+	if man.mergeSynopsis && man.wants(FieldOptions) {
+		man.mergeSynopsisOpts()
+	}
+	man.recordMistakes(data)
+}
+
+// Read the roff source of the man page 'filename', decompressing it as its
+// contents require.
+func readManFile(filename string) (string, error) {
 	fil, err := os.Open(filename)
 	if err != nil {
-		return nil, fmt.Errorf("error opening man page: %w", err)
+		return "", fmt.Errorf("error opening man page: %w", err)
 	}
 	defer fil.Close()
+	return readMan(fil)
+}
 
-	rdr, err := gzip.NewReader(fil)
+// Read the roff source of a man page from 'r', decompressing it as its
+// contents require.
+func readMan(r io.Reader) (string, error) {
+	rdr, err := decompress(r)
 	if err != nil {
-		return nil, fmt.Errorf("error building a reader: %w", err)
+		return "", err
 	}
 	defer rdr.Close()
 
 	data, err := ioutil.ReadAll(rdr)
 	if err != nil {
-		return nil, fmt.Errorf("error reading gzip data: %w", err)
+		return "", fmt.Errorf("error reading man page: %w", err)
 	}
+	return string(data), nil
+}
+
+// ParseOption adjusts how a man page is parsed
+type ParseOption func(*ManPage)
+
+// WithKeepFormatting keeps the roff escapes and macros of the sections and
+// option descriptions of man(7) pages, rather than reducing them to plain
+// text, for tooling that renders them again.  Names and the fields derived
+// from them, such as flags and prototypes, remain plain text.
+func WithKeepFormatting() ParseOption {
+	return func(m *ManPage) {
+		m.keepFormatting = true
+	}
+}
+
+// Instantiate and parse a man page given a man page path, which may be
+// uncompressed or compressed with gzip, bzip2 or lz4.  Pages that are just a
+// .so redirect to another page are parsed from their target, unless
+// WithIncludeResolution selects otherwise.
+func NewManPage(filename string, opts ...ParseOption) (*ManPage, error) {
+	man := ManPage{Path: filename}
+	for _, opt := range opts {
+		opt(&man)
+	}
+
+	data, err := readManFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if man.includes != IncludeNone {
+		man.Redirect, _ = soTarget(data)
+	}
+	if man.includes == IncludeEager {
+		if data, err = resolveIncludes(filename, data, man.includeDepth); err != nil {
+			return nil, err
+		}
+	}
+	man.parse(data)
+	if man.strict {
+		if err := man.checkStrict(); err != nil {
+			return nil, err
+		}
+	}
+	return &man, nil
+}
 
-	man.parse(string(data))
+// Instantiate and parse a man page given its uncompressed roff source.
+func NewManPageFromBytes(data []byte, opts ...ParseOption) (*ManPage, error) {
+	return NewManPageFromString(string(data), opts...)
+}
+
+// Instantiate and parse a man page given its uncompressed roff source.
+func NewManPageFromString(data string, opts ...ParseOption) (*ManPage, error) {
+	man := ManPage{}
+	for _, opt := range opts {
+		opt(&man)
+	}
+	if man.includes != IncludeNone {
+		man.Redirect, _ = soTarget(data)
+	}
+	man.parse(data)
+	if man.strict {
+		if err := man.checkStrict(); err != nil {
+			return nil, err
+		}
+	}
 	return &man, nil
 }
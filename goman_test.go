@@ -1,13 +1,19 @@
 package goman
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestNewManPage(t *testing.T) {
 	man, err := NewManPage("./test.1.gz") // Use the dummy testing man page
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatal(err)
 	}
 	name := "foobar"
 	if man.Name != name {
@@ -20,14 +26,1668 @@ func TestNewManPage(t *testing.T) {
 	}
 
 	opts := []Opt{
-		{"-q", "q is an option"},
-		{"-u", "u is an option"},
-		{"-x", "x is an option"},
+		{Name: "-q", Desc: "q is an option"},
+		{Name: "-u", Desc: "u is an option"},
+		{Name: "-x", Desc: "x is an option"},
 	}
 	for i, opt := range opts {
-		if man.Opts[i] != opt {
+		if !optEqual(man.Opts[i], opt) {
 			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
 		}
 	}
 
 }
+
+// Compare options, treating nil and empty slices alike
+func optEqual(a, b Opt) bool {
+	if len(a.Synonyms) == 0 && len(b.Synonyms) == 0 {
+		a.Synonyms, b.Synonyms = nil, nil
+	}
+	a.Raw, b.Raw = "", ""
+	return reflect.DeepEqual(a, b)
+}
+
+// Parse an in-memory man page
+func parseString(src string) *ManPage {
+	man := &ManPage{}
+	man.parse(src)
+	return man
+}
+
+const mdoc_page = `.Dd January 1, 2020
+.Dt FOOBAR 1
+.Os
+.Sh NAME
+.Nm foobar
+.Nd sample mdoc page
+.Sh SYNOPSIS
+.Nm
+.Op Fl qv
+.Ar file
+.Sh DESCRIPTION
+The
+.Nm
+utility does nothing.
+.Bl -tag -width Ds
+.It Fl q
+Be quiet.
+.It Fl v
+Be
+.Em verbose .
+.El
+.Sh BUGS
+None.
+`
+
+func TestFormat(t *testing.T) {
+	man, err := NewManPage("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Format != "man" {
+		t.Errorf("Format: expected 'man', found '%s'\n", man.Format)
+	}
+
+	man = parseString(mdoc_page)
+	if man.Format != "mdoc" {
+		t.Errorf("Format: expected 'mdoc', found '%s'\n", man.Format)
+	}
+
+	man = parseString("just some text\nwithout macros\n")
+	if man.Format != "unknown" {
+		t.Errorf("Format: expected 'unknown', found '%s'\n", man.Format)
+	}
+}
+
+// A formatted page, with overstruck bold headings and an underlined word
+const cat_page = "FOO(1)                 User Commands                FOO(1)\n\n" +
+	"N\bNA\bAM\bME\bE\n       foo - frobnicate things\n\n" +
+	"S\bSY\bYN\bNO\bOP\bPS\bSI\bIS\bS\n       foo [-q] _\bf_\bi_\bl_\be\n\n" +
+	"DESCRIPTION\n       Foo frobnicates\n       things.\n\n       Quietly.\n\n" +
+	"SEE ALSO\n       bar(1)\n"
+
+func TestCatPage(t *testing.T) {
+	man := parseString(cat_page)
+	if man.Format != "cat" {
+		t.Errorf("Format: expected 'cat', found '%s'\n", man.Format)
+	}
+	if man.Name != "foo" {
+		t.Errorf("Name: expected 'foo', found '%s'\n", man.Name)
+	}
+	if man.Summary != "frobnicate things" {
+		t.Errorf("Summary: expected 'frobnicate things', found '%s'\n", man.Summary)
+	}
+	if man.Synopsis != "foo [-q] file" {
+		t.Errorf("Synopsis: expected 'foo [-q] file', found '%s'\n", man.Synopsis)
+	}
+	desc := "Foo frobnicates things.\n\nQuietly."
+	if man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+}
+
+func TestWrappedHeader(t *testing.T) {
+	man := parseString(".TH FOO 1 2020-01-01 \"GNU \\\nfoo 1.2\" \\\n\"User Commands\"\n.SH NAME\nfoo\n")
+	if man.Source != "GNU foo 1.2" || man.Manual != "User Commands" {
+		t.Errorf("Header: expected 'GNU foo 1.2' 'User Commands', found '%s' '%s'\n",
+			man.Source, man.Manual)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	man := parseString(".TH LS 1 2022-04-01 \"GNU coreutils 9.1\" \"User Commands\"\n.SH NAME\nls\n")
+	if man.Version != "9.1" {
+		t.Errorf("Version: expected '9.1', found '%s'\n", man.Version)
+	}
+	man = parseString(pod_page)
+	if man.Version != "5.30.0" {
+		t.Errorf("Version: expected '5.30.0', found '%s'\n", man.Version)
+	}
+	man = parseString(".TH FOO 1 2022 \"foo 1.0\"\n.SH NAME\nfoo\n.SH VERSION\n2.0-beta\n")
+	if man.Version != "2.0-beta" {
+		t.Errorf("Version: expected '2.0-beta', found '%s'\n", man.Version)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	man := parseString(".TH LS 1\n.SH NAME\nls \\- list directory contents\n")
+	if man.Title != "LS" || man.Name != "ls" {
+		t.Errorf("Title: expected 'LS' and 'ls', found '%s' and '%s'\n", man.Title, man.Name)
+	}
+
+	// Text lines are never the header, whatever word they start with
+	man = parseString("TH is not a header\n.TH LS 1 2020-01-01\n.SH NAME\nls \\- list\n")
+	if man.Title != "LS" || man.SectionNumber != "1" || man.Date != "2020-01-01" {
+		t.Errorf("Title: expected 'LS' '1' '2020-01-01', found '%s' '%s' '%s'\n",
+			man.Title, man.SectionNumber, man.Date)
+	}
+
+	man = parseString(mdoc_page)
+	if man.Title != "FOOBAR" || man.Name != "foobar" {
+		t.Errorf("Title: expected 'FOOBAR' and 'foobar', found '%s' and '%s'\n", man.Title, man.Name)
+	}
+}
+
+func TestMdocHeader(t *testing.T) {
+	man := parseString(mdoc_page)
+	if man.Title != "FOOBAR" || man.SectionNumber != "1" || man.Date != "2020-01-01" ||
+		man.Source != "" {
+		t.Errorf("Header: found '%s' '%s' '%s' '%s'\n", man.Title,
+			man.SectionNumber, man.Date, man.Source)
+	}
+
+	man = parseString(strings.Replace(strings.Replace(mdoc_page, "January 1, 2020",
+		"$Mdocdate: March 4 2021 $", 1), ".Os", ".Os FreeBSD 13", 1))
+	if man.Date != "2021-03-04" || man.Source != "FreeBSD 13" {
+		t.Errorf("Header: expected '2021-03-04' 'FreeBSD 13', found '%s' '%s'\n",
+			man.Date, man.Source)
+	}
+
+	man = parseString(strings.Replace(mdoc_page, ".Os", ".Os\nDt is not a header", 1))
+	if man.Title != "FOOBAR" || man.SectionNumber != "1" {
+		t.Errorf("Header: expected 'FOOBAR' '1', found '%s' '%s'\n", man.Title, man.SectionNumber)
+	}
+}
+
+func TestMdocInternalRefs(t *testing.T) {
+	man := parseString(".Dd January 1, 2020\n.Dt FOO 1\n.Os\n.Sh NAME\n.Nm foo\n" +
+		".Nd frobnicate\n.Sh SYNOPSIS\n.Nm\n.Sh DESCRIPTION\nSee\n.Sx EXIT STATUS ,\n" +
+		".Sx SYNOPSIS\nand\n.Sx SYNOPSIS .\n.Sh EXIT STATUS\nZero.\n")
+	refs := []string{"EXIT STATUS", "SYNOPSIS"}
+	if !reflect.DeepEqual(man.InternalRefs, refs) {
+		t.Errorf("InternalRefs: expected %q, found %q\n", refs, man.InternalRefs)
+	}
+	desc := "See EXIT STATUS, SYNOPSIS and SYNOPSIS."
+	if man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+
+	doc := man.ToHTML()
+	for _, str := range []string{`<h2 id="sect-synopsis">SYNOPSIS</h2>`,
+		`<a href="#sect-synopsis">SYNOPSIS</a> and <a href="#sect-synopsis">SYNOPSIS</a>.`} {
+		if !strings.Contains(doc, str) {
+			t.Errorf("ToHTML: expected '%s' within '%s'\n", str, doc)
+		}
+	}
+}
+
+func TestMdoc(t *testing.T) {
+	man := parseString(mdoc_page)
+	if man.Name != "foobar" {
+		t.Errorf("Name: expected 'foobar', found '%s'\n", man.Name)
+	}
+
+	synopsis := "foobar [-qv] file"
+	if man.Synopsis != synopsis {
+		t.Errorf("Synopsis: expected '%s', found '%s'\n", synopsis, man.Synopsis)
+	}
+
+	desc := "The foobar utility does nothing. -q Be quiet. -v Be verbose."
+	if man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+
+	opts := []Opt{
+		{Name: "-q", Desc: "Be quiet."},
+		{Name: "-v", Desc: "Be verbose."},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %d, found %d\n", len(opts), len(man.Opts))
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestDescFromName(t *testing.T) {
+	man := parseString(".TH foo 3\n.SH NAME\nfoo \\- does a thing\n")
+	if man.Desc != "does a thing" {
+		t.Errorf("Desc: expected 'does a thing', found '%s'\n", man.Desc)
+	}
+
+	man = parseString(".Dd January 1, 2020\n.Sh NAME\n.Nm foo\n.Nd does a thing\n")
+	if man.Desc != "does a thing" {
+		t.Errorf("Desc: expected 'does a thing', found '%s'\n", man.Desc)
+	}
+}
+
+func TestUsageLine(t *testing.T) {
+	man := parseString(".SH NAME\nfoo \\- bar\n.SH SYNOPSIS\n.B foo\n[\\fIOPTION\\fR]...\n" +
+		"\\fIFILE\\fR\n.B foo\n\\-\\-help\n")
+	if usage := man.UsageLine(); usage != "foo [OPTION]... FILE" {
+		t.Errorf("UsageLine: expected 'foo [OPTION]... FILE', found '%s'\n", usage)
+	}
+
+	man = parseString(".SH NAME\nfoo \\- bar\n.SH SYNOPSIS\n.nf\nfoo  \\-q\n   file\nfoo \\-v\n.fi\n")
+	if usage := man.UsageLine(); usage != "foo -q file" {
+		t.Errorf("UsageLine: expected 'foo -q file', found '%s'\n", usage)
+	}
+
+	man = parseString(".SH NAME\nfoo \\- bar\n")
+	if usage := man.UsageLine(); usage != "foo" {
+		t.Errorf("UsageLine: expected 'foo', found '%s'\n", usage)
+	}
+}
+
+func TestSynopsisLines(t *testing.T) {
+	src := ".SH NAME\nfoo \\- bar\n.SH SYNOPSIS\n.B foo\n[\\fIOPTION\\fR]...\n" +
+		"\\fIFILE\\fR\n.B foo\n\\-\\-help\n.PP\n.B foo\n\\-\\-version\n"
+	forms := []string{"foo [OPTION]... FILE", "foo --help", "foo --version"}
+	for _, opts := range [][]ParseOption{nil, {WithKeepFormatting()}} {
+		man, err := NewManPageFromString(src, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := man.SynopsisLines(); !reflect.DeepEqual(lines, forms) {
+			t.Errorf("SynopsisLines: expected %q, found %q\n", forms, lines)
+		}
+	}
+
+	if lines := parseString(mdoc_page).SynopsisLines(); !reflect.DeepEqual(lines,
+		[]string{"foobar [-qv] file"}) {
+		t.Errorf("SynopsisLines: expected [foobar [-qv] file], found %q\n", lines)
+	}
+}
+
+func TestSynopsisTree(t *testing.T) {
+	man := parseString(".SH NAME\nfoo \\- bar\n.SH SYNOPSIS\n.B foo\n[\\-a | \\-b [\\fIlevel\\fR]]\n" +
+		"{\\-x|\\-y} [\\fIfile\\fR...]\n")
+	trees := man.SynopsisTree()
+	if len(trees) != 1 || trees[0].String() != "foo [-a | -b [level]] {-x | -y} [file...]" {
+		t.Fatalf("SynopsisTree: expected 'foo [-a | -b [level]] {-x | -y} [file...]', found %v\n", trees)
+	}
+
+	parts := trees[0].Children
+	opt := SynopsisNode{Kind: SynopsisOptional, Children: []SynopsisNode{{Kind: SynopsisChoice,
+		Children: []SynopsisNode{
+			{Kind: SynopsisWord, Text: "-a"},
+			{Kind: SynopsisSequence, Children: []SynopsisNode{
+				{Kind: SynopsisWord, Text: "-b"},
+				{Kind: SynopsisOptional, Children: []SynopsisNode{{Kind: SynopsisWord, Text: "level"}}},
+			}},
+		}}}}
+	if len(parts) != 4 || !reflect.DeepEqual(parts[1], opt) {
+		t.Fatalf("SynopsisTree: expected '%s' second, found %v\n", opt, parts)
+	}
+	if parts[2].Kind != SynopsisRequired || len(parts[2].Children) != 1 ||
+		parts[2].Children[0].Kind != SynopsisChoice {
+		t.Errorf("SynopsisTree: expected a choice of -x and -y, found '%s'\n", parts[2])
+	}
+	file := parts[3]
+	if file.Kind != SynopsisOptional || len(file.Children) != 1 || !file.Children[0].Repeat {
+		t.Errorf("SynopsisTree: expected an optional repeated file, found '%s'\n", file)
+	}
+}
+
+func TestMergeSynopsisOptions(t *testing.T) {
+	src := ".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH SYNOPSIS\n.B foo\n[\\-q] [\\-\\-color=\\fIWHEN\\fR] " +
+		"\\fIfile\\fR\n.SH OPTIONS\n.TP\n\\-q, \\-\\-quiet\nbe quiet\n.TP\n\\-v\nbe chatty\n"
+	man, err := NewManPageFromString(src, WithMergeSynopsisOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := []Opt{
+		{Name: "-q", Desc: "be quiet", Synonyms: []string{"--quiet"}, InSynopsis: true},
+		{Name: "-v", Desc: "be chatty"},
+		{Name: "--color", InSynopsis: true},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s' %v, found '%s' %v\n", opt, opt.InSynopsis,
+				man.Opts[i], man.Opts[i].InSynopsis)
+		}
+	}
+
+	// Bundled short flags name each of the documented options
+	man, err = NewManPageFromString(mdoc_page, WithMergeSynopsisOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(man.Opts) != 2 || !man.Opts[0].InSynopsis || !man.Opts[1].InSynopsis {
+		t.Errorf("Opts: expected -q and -v in the synopsis, found %v\n", man.Opts)
+	}
+
+	if man = parseString(src); len(man.Opts) != 2 || man.Opts[0].InSynopsis {
+		t.Errorf("Opts: expected no merging by default, found %v\n", man.Opts)
+	}
+}
+
+func TestIgnoreBlocks(t *testing.T) {
+	man := parseString(".ig\nCopyright (c) 2020 Someone\n.SH NAME\nnot \\- this\n..\n" +
+		".TH FOO 1\n.SH NAME\nfoo \\- does things\n.SH DESCRIPTION\nDoes\n" +
+		".ig EN\nhidden\n..\nstill hidden\n.EN\nthings.\n")
+	if man.Name != "foo" || man.Summary != "does things" {
+		t.Errorf("NAME: expected 'foo' and 'does things', found '%s' and '%s'\n",
+			man.Name, man.Summary)
+	}
+	if man.Desc != "Does things." {
+		t.Errorf("Desc: expected 'Does things.', found '%s'\n", man.Desc)
+	}
+
+	man = parseString(".ig \\\" license\nhidden\n..\n.SH NAME\nfoo \\- does things\n")
+	if man.Name != "foo" {
+		t.Errorf("Name: expected 'foo', found '%s'\n", man.Name)
+	}
+}
+
+func TestCopyright(t *testing.T) {
+	copyright := "Copyright (C) 2020 Someone.\nLicense GPLv3+: GNU GPL version 3 or later.\n\n" +
+		"This is free software."
+	man := parseString(".SH NAME\nfoo \\- does things\n.SH COPYRIGHT\n.\\\" the notice\n" +
+		"Copyright \\(co 2020   Someone.\n.br\nLicense GPLv3+: GNU GPL\n.B version 3\n" +
+		"or later.\n.PP\nThis is free software.\n.SH SEE ALSO\nbar(1)\n")
+	if man.Copyright != strings.Replace(copyright, "(C)", "©", 1) {
+		t.Errorf("Copyright: expected %q, found %q\n", copyright, man.Copyright)
+	}
+
+	man = parseString(".Dd January 1, 2020\n.Dt FOO 1\n.Os\n.Sh NAME\n.Nm foo\n" +
+		".Nd does things\n.Sh LICENSE\nCopyright (C) 2020 Someone.\n.br\n" +
+		"License GPLv3+: GNU GPL version 3 or later.\n.Pp\nThis is free software.\n")
+	if man.Copyright != copyright {
+		t.Errorf("Copyright: expected %q, found %q\n", copyright, man.Copyright)
+	}
+}
+
+func TestFields(t *testing.T) {
+	full, err := NewManPage("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	man, err := NewManPage("./test.1.gz", WithFields(FieldName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Name != full.Name || man.Summary != full.Summary {
+		t.Errorf("Name: expected '%s' '%s', found '%s' '%s'\n", full.Name,
+			full.Summary, man.Name, man.Summary)
+	}
+	if man.Desc != "" || man.Synopsis != "" || len(man.Opts) != 0 {
+		t.Errorf("WithFields(FieldName): expected no other fields, found %v\n", man)
+	}
+
+	man, err = NewManPage("./test.1.gz", WithFields(FieldName, FieldOptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Desc != "" || !reflect.DeepEqual(man.Opts, full.Opts) {
+		t.Errorf("Opts: expected %v, found %v\n", full.Opts, man.Opts)
+	}
+}
+
+func TestSectionComments(t *testing.T) {
+	man := parseString(".TH FOO 1\n.SH NAME\n.\\\" name\n\nfoo \\- bar\n.SH DESCRIPTION\n" +
+		".\\\" leading\n\n'\\\" other\nSome\n\\\" inline\ntext.\n.SH OPTIONS\n.\\\" first\n" +
+		".TP\n.\\\" tag\n.B \\-q\nbe quiet\n.\\\" more\nreally\n")
+	if man.Name != "foo" || man.Summary != "bar" {
+		t.Errorf("NAME: expected 'foo' and 'bar', found '%s' and '%s'\n", man.Name, man.Summary)
+	}
+	if man.Desc != "Some text." {
+		t.Errorf("Desc: expected 'Some text.', found '%s'\n", man.Desc)
+	}
+	opt := Opt{Name: "-q", Desc: "be quiet really"}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+
+	man = parseString(strings.Replace(mdoc_page, ".Sh DESCRIPTION\n",
+		".Sh DESCRIPTION\n.\\\" leading\n", 1))
+	if desc := "The foobar utility does nothing. -q Be quiet. -v Be verbose."; man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	page := ".TH FOO 1\n.SH NAME\nfoo \\- does things\n.de XX\n.B \\$1\n..\n" +
+		".SH DESCRIPTION\n.XX foo\n.nf\nverbatim\n.fi\n.ig\n.ZZ\n..\n"
+	if _, err := NewManPageFromString(page, WithStrict()); err != nil {
+		t.Errorf("WithStrict: expected no error, found %v\n", err)
+	}
+
+	tests := []struct {
+		page string
+		line int
+	}{
+		{page + ".ZZ\n", 15},
+		{page + ".nf\nverbatim\n.SH SEE ALSO\n", 15},
+		{page + ".fi\n", 15},
+		{strings.Replace(page, "NAME", "NOM", 1), 0},
+	}
+	for _, test := range tests {
+		if _, err := NewManPageFromString(test.page); err != nil {
+			t.Errorf("NewManPageFromString: expected no error, found %v\n", err)
+		}
+		_, err := NewManPageFromString(test.page, WithStrict())
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != test.line {
+			t.Errorf("WithStrict: expected a *ParseError at line %d, found %v\n",
+				test.line, err)
+		}
+	}
+}
+
+func TestKeepFormatting(t *testing.T) {
+	src := ".SH NAME\n\\fBfoo\\fR \\- does things\n.SH DESCRIPTION\n.B Foo\ndoes \\(em things.\n" +
+		".PP\nMore.\n.SH OPTIONS\n.TP\n\\fB\\-q\\fR\nbe \\fIquiet\\fP\n.I really\n"
+	man, err := NewManPageFromString(src, WithKeepFormatting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Name != "foo" {
+		t.Errorf("Name: expected 'foo', found '%s'\n", man.Name)
+	}
+	desc := ".B Foo\ndoes \\(em things.\n\nMore."
+	if man.Desc != desc {
+		t.Errorf("Desc: expected %q, found %q\n", desc, man.Desc)
+	}
+	opt := Opt{Name: "-q", Desc: "be \\fIquiet\\fP\n.I really"}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%q], found %q\n", opt, man.Opts)
+	}
+
+	if man = parseString(src); man.Desc != "Foo does — things.\n\nMore." {
+		t.Errorf("Desc: expected plain text by default, found %q\n", man.Desc)
+	}
+}
+
+func TestMissingSection(t *testing.T) {
+	man := parseString(".TH foo 1\n.SH NAME\nfoo \\- does a thing\n")
+	if man.Synopsis != "" {
+		t.Errorf("Synopsis: expected '', found '%s'\n", man.Synopsis)
+	}
+	if _, ok := man.getSection("SYNOPSIS"); ok {
+		t.Errorf("getSection: found a SYNOPSIS section that does not exist\n")
+	}
+	if _, ok := man.getSection("NAME"); !ok {
+		t.Errorf("getSection: failed to find the NAME section\n")
+	}
+	if start, end, err := man.findSection("NAME"); err != nil || start != 10 || end != 18 {
+		t.Errorf("findSection: expected heading at 10-18, found %d-%d %v\n", start, end, err)
+	}
+	if _, _, err := man.findSection("SYNOPSIS"); err == nil {
+		t.Errorf("findSection: expected an error for a missing section\n")
+	}
+}
+
+func TestOptTabs(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.IP -q\tbe\n\tquiet\t\tplease\t\n")
+	opt := Opt{Name: "-q", Desc: "be quiet please"}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+}
+
+func TestOptParagraphs(t *testing.T) {
+	man := parseString(".SH OPTIONS\n" +
+		".IP -q\nbe quiet\n.PP\nreally quiet\n.RS 4\nindented\n.RE\n" +
+		".IP -v\nbe verbose\n\n.SH BUGS\nnone\n")
+	opts := []Opt{
+		{Name: "-q", Desc: "be quiet\n\nreally quiet indented"},
+		{Name: "-v", Desc: "be verbose"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestDescOptsFallback(t *testing.T) {
+	man := parseString(".SH DESCRIPTION\nSome prose.\n" +
+		".B well-known\nbehavior is described here.\n.I emphasis\n" +
+		".IP -q\nbe quiet\n.SH BUGS\n.B -x\nnot an option\n")
+	opt := Opt{Name: "-q", Desc: "be quiet"}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+
+	// Flags mentioned in prose, lists and subsections between the entries
+	man = parseString(".SH DESCRIPTION\n.B foo\nfrobnicates, unlike\n.B \\-x\n" +
+		"in passing.\n.SS General\n.TP\n.B \\-q\nbe quiet\n.RS\n.IP \\(bu 2\nreally\n" +
+		".IP quite 2\nso\n.RE\n.nf\nfoo \\-q\n.fi\n.SS Output\n.TP\n\\fB\\-v\\fR, \\fB\\-\\-verbose\\fR\n" +
+		"be verbose\n.TP\n.I file\nthe file\n.SH EXIT STATUS\n.TP\n.B \\-1\nnot an option\n")
+	opts := []Opt{
+		{Name: "-q", Desc: "be quiet\n\nreally\n\nquite so"},
+		{Name: "-v", Desc: "be verbose", Synonyms: []string{"--verbose"}},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestOptDedupSort(t *testing.T) {
+	man := parseString(".SH OPTIONS\n" +
+		".IP -x\nx is an option\n.IP --all\nall of it\n" +
+		".IP -b\nb is an option\n.IP -x\nx is an option\n.IP -b\nsee above\n" +
+		".IP \"-v, --verbose\"\nbe chatty\n.IP --verbose\nbe chatty\n.IP \"-q, --quiet\"\nbe quiet\n" +
+		".IP \"--silent, -q\"\nbe quiet\n")
+	opts := []Opt{
+		{Name: "-x", Desc: "x is an option"},
+		{Name: "--all", Desc: "all of it"},
+		{Name: "-b", Desc: "b is an option\n\nsee above"},
+		{Name: "-v", Desc: "be chatty", Synonyms: []string{"--verbose"}},
+		{Name: "-q", Desc: "be quiet", Synonyms: []string{"--quiet", "--silent"}},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+
+	man.SortOptions()
+	for i, name := range []string{"--all", "-b", "-q", "-v", "-x"} {
+		if man.Opts[i].Name != name {
+			t.Errorf("SortOptions: expected '%s', found '%s'\n", name, man.Opts[i].Name)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	man := parseString(".SH OPTIONS\n" +
+		".B -v, --verbose\nbe chatty\n.IP -q\nbe quiet\n")
+	opts := man.Options()
+	if len(opts) != 3 {
+		t.Fatalf("Options: expected 3 entries, found %v\n", opts)
+	}
+	verbose := Opt{Name: "-v", Desc: "be chatty", Synonyms: []string{"--verbose"}}
+	for _, flag := range []string{"-v", "--verbose"} {
+		if !optEqual(opts[flag], verbose) {
+			t.Errorf("Options: expected '%s', found '%s'\n", verbose, opts[flag])
+		}
+	}
+	if opts["-q"].Desc != "be quiet" {
+		t.Errorf("Options: expected 'be quiet', found '%s'\n", opts["-q"].Desc)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	man, err := NewManPage("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := man.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo: reported %d bytes, wrote %d\n", n, buf.Len())
+	}
+	if buf.String() != man.String() {
+		t.Errorf("WriteTo: expected '%s', found '%s'\n", man.String(), buf.String())
+	}
+}
+
+func TestRoffSource(t *testing.T) {
+	src := ".TH FOO 1\n.ig\nlicense\n..\n.SH NAME\nfoo \\- \\\nbar\n.SH OPTIONS\n.TP\n\\-q\nbe quiet\n"
+	man := parseString(src)
+	text, err := RoffSource{man}.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != src {
+		t.Errorf("MarshalText: expected %q, found %q\n", src, text)
+	}
+	var other RoffSource
+	if err := other.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !other.Page.Equal(man) {
+		t.Errorf("UnmarshalText: expected '%s', found '%s'\n", man, other.Page)
+	}
+
+	// Only the wrapper encodes as roff, a page itself is an object of fields
+	data, err := json.Marshal(struct{ Page RoffSource }{RoffSource{man}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wrapped struct{ Page string }
+	if err := json.Unmarshal(data, &wrapped); err != nil || wrapped.Page != src {
+		t.Errorf("Marshal: expected the roff source as a string, found %s\n", data)
+	}
+	if data, err = json.Marshal(man); err != nil {
+		t.Fatal(err)
+	}
+	var fields struct{ Name, Summary string }
+	if err := json.Unmarshal(data, &fields); err != nil || fields.Name != "foo" {
+		t.Errorf("Marshal: expected an object of the page's fields, found %s\n", data)
+	}
+}
+
+func TestGenerateManPage(t *testing.T) {
+	opts := []Opt{
+		{Name: "-q", Desc: "be quiet"},
+		{Name: "-v", Desc: "be chatty\n\nreally", Synonyms: []string{"--verbose"}},
+		{Name: "-e", Desc: `match \fB literally, as in a\-b`},
+	}
+	desc := "Does foo. Also \\ things.\n\nAnd bar, e.g. \\fB."
+	src := GenerateManPage("foobar", "1", opts, `foobar [-qv] [-e \fB]`, desc)
+	man, err := NewManPageFromString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Name != "foobar" || man.Summary != "Does foo" {
+		t.Errorf("Name: expected 'foobar' 'Does foo', found '%s' '%s'\n", man.Name, man.Summary)
+	}
+	if man.Synopsis != `foobar [-qv] [-e \fB]` {
+		t.Errorf("Synopsis: expected 'foobar [-qv] [-e \\fB]', found '%s'\n", man.Synopsis)
+	}
+	if man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+const examples_page = `.TH foo 1
+.SH NAME
+foo \- does a thing
+.SH EXAMPLES
+Run it like so:
+.EX
+$ foo -q
+  done
+.EE
+and it finishes.
+`
+
+func TestExamples(t *testing.T) {
+	man := parseString(examples_page)
+	examples := "Run it like so:\n\n$ foo -q\n  done\n\nand it finishes."
+	if man.Examples != examples {
+		t.Errorf("Examples: expected '%s', found '%s'\n", examples, man.Examples)
+	}
+
+	md := man.ToMarkdown()
+	fence := "\n```\n$ foo -q\n  done\n```\n"
+	if !strings.Contains(md, fence) {
+		t.Errorf("ToMarkdown: expected a fenced example, found '%s'\n", md)
+	}
+}
+
+const library_page = `.TH STRDUP 3 2020-01-01 "GNU" "Linux Programmer's Manual"
+.SH NAME
+strdup \- duplicate a string
+.SH SYNOPSIS
+.nf
+.B #include <string.h>
+.PP
+.BI "char *strdup(const char *" s );
+.BI "int qsort_r(void *" base ", int (*" compar ")(const void *, void *), void *" arg );
+.BI "int rand(void);"
+.fi
+.SH DESCRIPTION
+Duplicates a string.
+.SH RETURN VALUE
+A pointer to the
+duplicated string.
+.PP
+NULL when out of memory.
+`
+
+func TestRender(t *testing.T) {
+	man := parseString(".SH NAME\nfoo \\- frobnicate\n.SH DESCRIPTION\n" +
+		"Frobnicates all of the things it is given.\n.SH OPTIONS\n.TP\n-q\nbe quiet\n")
+	for _, format := range []Format{Text, HTML, Markdown} {
+		if _, err := man.Render(format, RenderOptions{}); err != nil {
+			t.Errorf("Render(%v): %v\n", format, err)
+		}
+	}
+	if str, _ := man.Render(HTML, RenderOptions{}); str != man.ToHTML() {
+		t.Errorf("Render(HTML): expected the output of ToHTML, found '%s'\n", str)
+	}
+
+	ansi, err := man.Render(ANSI, RenderOptions{Width: 30, Color: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "\x1b[1mNAME\x1b[0m\n       foo - frobnicate\n\n" +
+		"\x1b[1mDESCRIPTION\x1b[0m\n       Frobnicates all of the\n" +
+		"       things it is given.\n\n\x1b[1mOPTIONS\x1b[0m\n" +
+		"       \x1b[1m-q\x1b[0m\n              be quiet\n"
+	if ansi != expect {
+		t.Errorf("Render(ANSI): expected %q, found %q\n", expect, ansi)
+	}
+
+	man = parseString(".SH NAME\nfoo \\- frobnicate\n.SH DESCRIPTION\nOne.\n.PP\n.PP\n" +
+		".sp 3\nTwo.\n.SH EXAMPLES\n.nf\nfoo\n\n\n\nbar\n.fi\n")
+	man.Desc += "\n\n\n\n"
+	expect = "Name:     foo\nDesc:     One.\n\nTwo.\n\nSynposis: \nExamples:\nfoo\n\n\n\nbar\n"
+	if text := man.ToText(); text != expect {
+		t.Errorf("ToText: expected %q, found %q\n", expect, text)
+	}
+	expect = "Name:     foo\nDesc:     One.\n\nTwo.\n\n\nSynposis: \nExamples:\nfoo\n\n\n\nbar\n"
+	if text, _ := man.Render(Text, RenderOptions{}.WithMaxBlankLines(2)); text != expect {
+		t.Errorf("Render(Text): expected %q, found %q\n", expect, text)
+	}
+	expect = "Name:     foo\nDesc:     One.\nTwo.\nSynposis: \nExamples:\nfoo\n\n\n\nbar\n"
+	if text, _ := man.Render(Text, RenderOptions{}.WithMaxBlankLines(0)); text != expect {
+		t.Errorf("Render(Text): expected %q, found %q\n", expect, text)
+	}
+	ansi, _ = man.Render(ANSI, RenderOptions{MaxBlankLines: -1})
+	if !strings.Contains(ansi, "foo\n\n\n\n       bar") || strings.Contains(ansi, "Two.\n\n\n") {
+		t.Errorf("Render(ANSI): expected the example's blank lines only, found %q\n", ansi)
+	}
+	if md := man.ToMarkdown(); !strings.Contains(md, "foo\n\n\n\nbar") ||
+		strings.Contains(md, "Two.\n\n\n") {
+		t.Errorf("ToMarkdown: expected the example's blank lines only, found %q\n", md)
+	}
+
+	if _, err := man.Render(Format(42), RenderOptions{}); err == nil {
+		t.Errorf("Render: expected an error for an unknown format\n")
+	}
+}
+
+func TestNotes(t *testing.T) {
+	man := parseString(".SH NOTES\nSome\nnotes.\n.PP\nMore.\n.SH BUGS\nNone.\n")
+	if man.Notes != "Some notes.\n\nMore." {
+		t.Errorf("Notes: expected 'Some notes.\\n\\nMore.', found '%s'\n", man.Notes)
+	}
+	man = parseString(".SH \"IMPLEMENTATION NOTES\"\nFast.\n")
+	if man.Notes != "Fast." {
+		t.Errorf("Notes: expected 'Fast.', found '%s'\n", man.Notes)
+	}
+	if man = parseString(library_page); man.Notes != "" {
+		t.Errorf("Notes: expected '', found '%s'\n", man.Notes)
+	}
+}
+
+func TestStandards(t *testing.T) {
+	man := parseString(".SH CONFORMING TO\nPOSIX.1-2001, POSIX.1-2008,\nC99.\n.PP\nSVr4\n")
+	stds := []string{"POSIX.1-2001", "POSIX.1-2008", "C99", "SVr4"}
+	if !reflect.DeepEqual(man.Standards, stds) {
+		t.Errorf("Standards: expected %q, found %q\n", stds, man.Standards)
+	}
+
+	man = parseString(strings.Replace(mdoc_page, ".Sh BUGS", ".Sh STANDARDS\nPOSIX.1, C99\n.Sh BUGS", 1))
+	if !reflect.DeepEqual(man.Standards, []string{"POSIX.1", "C99"}) {
+		t.Errorf("Standards: expected [POSIX.1 C99], found %q\n", man.Standards)
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	man := parseString(".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH KEYWORDS\nfiles, copying,\ndisk usage.\n")
+	keywords := []string{"files", "copying", "disk usage"}
+	if !reflect.DeepEqual(man.Keywords, keywords) {
+		t.Errorf("Keywords: expected %q, found %q\n", keywords, man.Keywords)
+	}
+	if found := man.DeriveKeywords(2); !reflect.DeepEqual(found, keywords[:2]) {
+		t.Errorf("DeriveKeywords: expected %q, found %q\n", keywords[:2], found)
+	}
+	if found := man.DeriveKeywords(-1); !reflect.DeepEqual(found, keywords) {
+		t.Errorf("DeriveKeywords: expected %q, found %q\n", keywords, found)
+	}
+
+	man = parseString(".TH CP 1\n.SH NAME\ncp \\- copy files\n.SH DESCRIPTION\n" +
+		"The cp utility copies files, or copies a directory of files.\n")
+	if len(man.Keywords) != 0 {
+		t.Errorf("Keywords: expected none, found %q\n", man.Keywords)
+	}
+	keywords = []string{"files", "copies"}
+	if found := man.DeriveKeywords(2); !reflect.DeepEqual(found, keywords) {
+		t.Errorf("DeriveKeywords: expected %q, found %q\n", keywords, found)
+	}
+	if found := man.DeriveKeywords(0); len(found) < 3 || found[0] != "files" {
+		t.Errorf("DeriveKeywords: expected every word, found %q\n", found)
+	}
+}
+
+func TestPrototypes(t *testing.T) {
+	man := parseString(library_page)
+	if man.Title != "STRDUP" || man.SectionNumber != "3" || man.Date != "2020-01-01" ||
+		man.Source != "GNU" || man.Manual != "Linux Programmer's Manual" {
+		t.Errorf("Header: found '%s' '%s' '%s' '%s' '%s'\n", man.Title,
+			man.SectionNumber, man.Date, man.Source, man.Manual)
+	}
+
+	if !reflect.DeepEqual(man.Includes, []string{"string.h"}) {
+		t.Errorf("Includes: expected [string.h], found %v\n", man.Includes)
+	}
+	protos := []Prototype{
+		{"char *", "strdup", []string{"const char * s"}},
+		{"int", "qsort_r", []string{"void * base", "int (* compar )(const void *, void *)", "void * arg"}},
+		{"int", "rand", nil},
+	}
+	if !reflect.DeepEqual(man.Prototypes, protos) {
+		t.Errorf("Prototypes: expected %v, found %v\n", protos, man.Prototypes)
+	}
+
+	ret := "A pointer to the duplicated string.\n\nNULL when out of memory."
+	if man.ReturnValue != ret {
+		t.Errorf("ReturnValue: expected '%s', found '%s'\n", ret, man.ReturnValue)
+	}
+	man = parseString(strings.Replace(library_page, "RETURN VALUE", "RETURN VALUES", 1))
+	if man.ReturnValue != ret {
+		t.Errorf("ReturnValue: expected '%s', found '%s'\n", ret, man.ReturnValue)
+	}
+
+	man = parseString(strings.Replace(library_page, "STRDUP 3", "STRDUP 1", 1))
+	if len(man.Prototypes) != 0 {
+		t.Errorf("Prototypes: expected none for section 1, found %v\n", man.Prototypes)
+	}
+}
+
+func TestMdocPrototypes(t *testing.T) {
+	man := parseString(".Dd January 1, 2020\n.Dt STRDUP 3\n.Os\n.Sh NAME\n.Nm strdup\n" +
+		".Nd duplicate a string\n.Sh SYNOPSIS\n.In string.h\n.Fd #include <stdlib.h>\n" +
+		".Ft char *\n.Fn strdup \"const char *s\"\n.Ft int\n.Fo qsort_r\n.Fa \"void *base\"\n" +
+		".Fa \"int (*compar)(const void *, void *)\"\n.Fa \"void *arg\"\n.Fc\n.Ft int\n" +
+		".Fn rand void\n.Sh DESCRIPTION\nThe\n.Fn strdup\nfunction duplicates\n.Fa s .\n")
+	if includes := []string{"string.h", "stdlib.h"}; !reflect.DeepEqual(man.Includes, includes) {
+		t.Errorf("Includes: expected %v, found %v\n", includes, man.Includes)
+	}
+	protos := []Prototype{
+		{"char *", "strdup", []string{"const char *s"}},
+		{"int", "qsort_r", []string{"void *base", "int (*compar)(const void *, void *)", "void *arg"}},
+		{"int", "rand", nil},
+	}
+	if !reflect.DeepEqual(man.Prototypes, protos) {
+		t.Errorf("Prototypes: expected %v, found %v\n", protos, man.Prototypes)
+	}
+}
+
+func TestMdocDisplays(t *testing.T) {
+	man := parseString(".Dd January 1, 2020\n.Dt FOO 1\n.Os\n.Sh NAME\n.Nm foo\n" +
+		".Nd does a thing\n.Sh EXAMPLES\nRun it with:\n.Bd -literal -offset indent\n" +
+		"foo  -a\n\tfoo -b\n.Ed\n.Bd -filled\nthen\ncheck\n.Ed\n")
+	examples := "Run it with:\n\nfoo  -a\n\tfoo -b\n\nthen check"
+	if man.Examples != examples {
+		t.Errorf("Examples: expected '%s', found '%s'\n", examples, man.Examples)
+	}
+}
+
+func TestIsStub(t *testing.T) {
+	pages := map[string]bool{
+		".so man1/bar.1\n":                                             true,
+		".TH FOO 1\n.SH NAME\nfoo \\- bar\n":                           true,
+		".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH DESCRIPTION\n.PP\n":     true,
+		".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH \"SEE ALSO\"\nbaz(1)\n": true,
+		".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH DESCRIPTION\nBars.\n":   false,
+		mdoc_page: false,
+		cat_page:  false,
+	}
+	for src, stub := range pages {
+		if found := parseString(src).IsStub(); found != stub {
+			t.Errorf("IsStub: expected %v, found %v for '%s'\n", stub, found, src)
+		}
+	}
+}
+
+func TestLineEndings(t *testing.T) {
+	src := ".TH foo 1\n.SH NAME\nfoo \\- does a thing\n.SH OPTIONS\n.IP -q\nbe quiet\n"
+	for _, eol := range []string{"\r\n", "\r"} {
+		man := parseString(strings.ReplaceAll(src, "\n", eol))
+		if man.Name != "foo" {
+			t.Errorf("Name: expected 'foo', found '%s'\n", man.Name)
+		}
+		opt := Opt{Name: "-q", Desc: "be quiet"}
+		if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+			t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+		}
+	}
+}
+
+func TestOptBullets(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.IP -q\nbe quiet\n" +
+		".IP \\(bu 2\nfirst - item\n.IP - 2\nsecond -item\n.IP -v\nbe chatty\n")
+	opts := []Opt{
+		{Name: "-q", Desc: "be quiet"},
+		{Name: "-v", Desc: "be chatty"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestOptArg(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.B \\-\\-color\\fR[=\\fIWHEN\\fR]\n" +
+		"colorize the \\fBoutput\\fR\n")
+	opt := Opt{Name: "--color", Arg: "WHEN", OptionalArg: true, Desc: "colorize the output"}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+
+	man = parseString(".SH OPTIONS\n.TP\n\\fB\\-\\-width\\fR=\\fICOLS\\fR\nwrap at COLS\n" +
+		".TP\n\\fB\\-o\\fR[\\fIfile\\fR]\nwrite to file\n")
+	opts := []Opt{
+		{Name: "--width", Arg: "COLS", Desc: "wrap at COLS"},
+		{Name: "-o", Arg: "file", OptionalArg: true, Desc: "write to file"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+	for i, str := range []string{"--width=COLS: wrap at COLS", "-o[file]: write to file"} {
+		if man.Opts[i].String() != str {
+			t.Errorf("String: expected '%s', found '%s'\n", str, man.Opts[i].String())
+		}
+	}
+}
+
+func TestOptRaw(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.B \\-v\n.B \\-\\-verbose\nbe \\fBchatty\\fR\n" +
+		".TP\n\\fB\\-q\\fR\nbe quiet\n.PP\nreally\n")
+	raws := []string{".B \\-v\n.B \\-\\-verbose\nbe \\fBchatty\\fR",
+		".TP\n\\fB\\-q\\fR\nbe quiet\n.PP\nreally"}
+	if len(man.Opts) != len(raws) {
+		t.Fatalf("Opts: expected %d options, found %v\n", len(raws), man.Opts)
+	}
+	for i, raw := range raws {
+		if man.Opts[i].Raw != raw {
+			t.Errorf("Raw: expected %q, found %q\n", raw, man.Opts[i].Raw)
+		}
+	}
+}
+
+func TestSplitFlags(t *testing.T) {
+	tests := []struct {
+		tag, arg, rest string
+		flags          []string
+	}{
+		{"-v, --verbose be chatty", "", " be chatty", []string{"-v", "--verbose"}},
+		{"--file=NAME read NAME", "=NAME", " read NAME", []string{"--file"}},
+		{"-f,--file=NAME, -F x", "=NAME", " x", []string{"-f", "--file", "-F"}},
+		{"--color[=WHEN]", "[=WHEN]", "", []string{"--color"}},
+	}
+	for _, test := range tests {
+		flags, arg, rest := splitFlags(test.tag)
+		if !reflect.DeepEqual(flags, test.flags) || arg != test.arg || rest != test.rest {
+			t.Errorf("splitFlags(%q): expected %v %q %q, found %v %q %q\n", test.tag,
+				test.flags, test.arg, test.rest, flags, arg, rest)
+		}
+	}
+}
+
+func TestOptTPFontTag(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.TP\n.B \\-\\-verbose\nbe chatty\n" +
+		".TP\n.BR \\-\\-output = file\nwrite to file\n")
+	opts := []Opt{
+		{Name: "--verbose", Desc: "be chatty"},
+		{Name: "--output", Arg: "file", Desc: "write to file"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestOptPlaceholder(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.TP\n\\fB\\-o\\fR <\\fIfile\\fR>\nwrite to file\n" +
+		".TP\n.BI \\-\\-output \" FILE\"\nwrite to FILE\n.TP\n\\-n N\nrepeat N times\n" +
+		".TP\n\\-q\nQUIET mode\n")
+	opts := []Opt{
+		{Name: "-o", Arg: "<file>", Desc: "write to file"},
+		{Name: "--output", Arg: "FILE", Desc: "write to FILE"},
+		{Name: "-n", Arg: "N", Desc: "repeat N times"},
+		{Name: "-q", Desc: "QUIET mode"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+	if str := "-o <file>: write to file"; man.Opts[0].String() != str {
+		t.Errorf("String: expected '%s', found '%s'\n", str, man.Opts[0].String())
+	}
+}
+
+// quoted.1.gz heads its sections as .SH"NAME", with no blank before the name
+func TestUnspacedHeadings(t *testing.T) {
+	man, err := NewManPage("./quoted.1.gz", WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Title != "QUOTED" || man.Name != "quoted" {
+		t.Errorf("Name: expected 'QUOTED' and 'quoted', found '%s' and '%s'\n", man.Title, man.Name)
+	}
+	desc := "Headings run straight into their quoted names."
+	if man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+	if len(man.Opts) != 1 || man.Opts[0].Name != "-q" || man.Opts[0].Desc != "be quiet" {
+		t.Errorf("Opts: expected [-q: be quiet], found %v\n", man.Opts)
+	}
+	names := []string{"NAME", "SYNOPSIS", "DESCRIPTION", "OPTIONS"}
+	if found := man.SectionNames(); !reflect.DeepEqual(found, names) {
+		t.Errorf("SectionNames: expected %q, found %q\n", names, found)
+	}
+}
+
+func TestFontRequest(t *testing.T) {
+	src := ".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH EXAMPLES\n.nf\n.ft B\nfoo \\-q\n.ft\nquiet\n.fi\n" +
+		".SH DESCRIPTION\n.ft 2\nitalic\n.ft R\nplain\n"
+	man := parseString(src)
+	if man.Examples != "foo -q\nquiet" || man.Desc != "italic plain" {
+		t.Errorf("Font: expected 'foo -q\nquiet' and 'italic plain', found '%s' and '%s'\n",
+			man.Examples, man.Desc)
+	}
+
+	man, err := NewManPageFromString(src, WithKeepFormatting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Examples != "\\fBfoo \\-q\\fR\nquiet" {
+		t.Errorf("Font: expected '\\fBfoo \\-q\\fR\nquiet', found '%s'\n", man.Examples)
+	}
+	if !strings.Contains(man.Desc, "\\fIitalic\\fR") || strings.Contains(man.Desc, ".ft") {
+		t.Errorf("Font: expected '\\fIitalic\\fR' without .ft, found '%s'\n", man.Desc)
+	}
+}
+
+func TestLineContinuation(t *testing.T) {
+	man := parseString(".TH FOO 1\n.SH NAME\nfoo \\- does \\\na thing\n.SH OPTIONS\n" +
+		".TP\n.B \\-\\-very\\\n-long\nis long\n.TP\n.B \\-e\nends in \\\\\n")
+	if man.Summary != "does a thing" {
+		t.Errorf("Summary: expected 'does a thing', found '%s'\n", man.Summary)
+	}
+	opts := []Opt{{Name: "--very-long", Desc: "is long"}, {Name: "-e", Desc: "ends in \\"}}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestNextLineFont(t *testing.T) {
+	man := parseString(".SH DESCRIPTION\nSome\n.B\nbold\n.I\n\"quoted\" text.\n.TP\n.B\n\\-q\n" +
+		"be quiet\n.SH SEE ALSO\n.B\n.B bar\n")
+	if desc := "Some bold \"quoted\" text.\n\n-q be quiet"; man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+	opt := Opt{Name: "-q", Desc: "be quiet"}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+
+	man = parseString(".SH OPTIONS\n.IP\n.B\n\\-v\n.B\n\\-\\-verbose\nbe verbose\n")
+	opt = Opt{Name: "-v", Desc: "be verbose", Synonyms: []string{"--verbose"}}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+}
+
+func TestOptTQ(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.TP\n.B \\-v\n.TQ\n.B \\-\\-verbose\n.TQ\n" +
+		"\\fB\\-\\-chatty\\fR\nbe chatty\n.TP\n\\-o\n.TQ\n\\-\\-output=FILE\n" +
+		"write to FILE\n.TP\n\\-q\nbe quiet\n")
+	opts := []Opt{
+		{Name: "-v", Desc: "be chatty", Synonyms: []string{"--verbose", "--chatty"}},
+		{Name: "-o", Arg: "FILE", Desc: "write to FILE", Synonyms: []string{"--output"}},
+		{Name: "-q", Desc: "be quiet"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestOptChildren(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.TP\n.BI \\-o \" opts\"\nset the options:\n.RS\n" +
+		".TP\n.B \\-ro\nread only\n.TP\n.B \\-rw\nread and write\n.RE\n" +
+		".TP\n.B \\-q\nbe quiet\n")
+	if len(man.Opts) != 2 || man.Opts[0].Name != "-o" || man.Opts[1].Name != "-q" {
+		t.Fatalf("Opts: expected [-o -q], found %v\n", man.Opts)
+	}
+	children := []Opt{{Name: "-ro", Desc: "read only"}, {Name: "-rw", Desc: "read and write"}}
+	if found := man.Opts[0].Children; len(found) != len(children) {
+		t.Errorf("Children: expected %v, found %v\n", children, found)
+	} else {
+		for i, opt := range children {
+			if !optEqual(found[i], opt) {
+				t.Errorf("Children: expected '%s', found '%s'\n", opt, found[i])
+			}
+		}
+	}
+	if len(man.Opts[1].Children) != 0 {
+		t.Errorf("Children: expected none for -q, found %v\n", man.Opts[1].Children)
+	}
+}
+
+func TestOptSameLineDesc(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.BI \\-o \" file\"\nwrite to\n.I file\ninstead\n" +
+		".TP\n\\-q be quiet\n.B \\-v be chatty\n")
+	opts := []Opt{
+		{Name: "-o", Desc: "file write to file instead"},
+		{Name: "-q", Desc: "be quiet"},
+		{Name: "-v", Desc: "be chatty"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestOptIPTag(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.IP \"\\-v, \\-\\-verbose\" 4\nbe chatty\n" +
+		".IP \\(bu 2\nnot an option\n.IP \\fB\\-q\\fR 4\nbe quiet\n")
+	opts := []Opt{
+		{Name: "-v", Desc: "be chatty", Synonyms: []string{"--verbose"}},
+		{Name: "-q", Desc: "be quiet"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestOptSynonymLines(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.B \\-v\n.B \\-\\-verbose\nbe chatty\n" +
+		".B \\-q\nbe quiet\n")
+	opts := []Opt{
+		{Name: "-v", Desc: "be chatty", Synonyms: []string{"--verbose"}},
+		{Name: "-q", Desc: "be quiet"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestStripEscapes(t *testing.T) {
+	tests := map[string]string{
+		`\fBbold\fR and \fIitalic\fP`:   "bold and italic",
+		`\f(CWmono\f[] \-\-flag`:        "mono --flag",
+		`\(bu item \[em] dash`:          "• item — dash",
+		`back\eslash \(zz`:              `back\slash \(zz`,
+		`\&.dot \&\-\&flag\& \fB\&x\fR`: ".dot -flag x",
+		`lit\\&eral \%hy\:phen\|s`:      `lit\&eral hyphens`,
+		`\-o\ file \fB\-n\~num\fR`:      "-o file -n num",
+	}
+	for in, out := range tests {
+		if found := stripEscapes(in); found != out {
+			t.Errorf("stripEscapes: expected '%s', found '%s'\n", out, found)
+		}
+	}
+}
+
+func TestStripRoff(t *testing.T) {
+	in := ".\\\" a comment\n.B \\-\\-verbose\nbe \\fIchatty\\fR\n.br\n.BR ls (1)\n.SH \"SEE ALSO\""
+	out := "--verbose\nbe chatty\nls(1)\nSEE ALSO"
+	if found := StripRoff(in); found != out {
+		t.Errorf("StripRoff: expected %q, found %q\n", out, found)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	man, err := NewManPage("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Summary != "Sample man page" {
+		t.Errorf("Summary: expected 'Sample man page', found '%s'\n", man.Summary)
+	}
+
+	man = parseString(mdoc_page)
+	if man.Summary != "sample mdoc page" {
+		t.Errorf("Summary: expected 'sample mdoc page', found '%s'\n", man.Summary)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	tests := map[string]string{
+		"/usr/share/man/de/man1/ls.1.gz":          "de",
+		"/usr/share/man/pt_BR.UTF-8/man8/ip.8.gz": "pt_BR.UTF-8",
+		"/usr/share/man/man1/ls.1.gz":             "",
+		"./test.1.gz":                             "",
+		"man/fr/man5/passwd.5":                    "fr",
+		"/opt/foo/man1/ls.1":                      "",
+		"/usr/share/de/man1/x.1":                  "",
+		"de/man1/x.1":                             "",
+	}
+	for path, locale := range tests {
+		man := &ManPage{Path: path}
+		man.parse(".TH LS 1\n")
+		if man.Locale != locale {
+			t.Errorf("Locale: expected '%s' for %s, found '%s'\n", locale, path, man.Locale)
+		}
+	}
+}
+
+func TestLayoutRequests(t *testing.T) {
+	man := parseString(".SH DESCRIPTION\n.ce 2\nCentered\ntext\n.ti 4\nindented.\n" +
+		".SH OPTIONS\n.IP -q\nbe\n.ti 2\nquiet\n")
+	if man.Desc != "Centered text indented." {
+		t.Errorf("Desc: expected 'Centered text indented.', found '%s'\n", man.Desc)
+	}
+	opt := Opt{Name: "-q", Desc: "be quiet"}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+}
+
+func TestBugs(t *testing.T) {
+	man, err := NewManPage("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Bugs != "This is flawless" {
+		t.Errorf("Bugs: expected 'This is flawless', found '%s'\n", man.Bugs)
+	}
+
+	man = parseString(".SH NAME\nfoo\n.SH CAVEATS\nMind\nthe  gap.\n")
+	if man.Bugs != "Mind the gap." {
+		t.Errorf("Bugs: expected 'Mind the gap.', found '%s'\n", man.Bugs)
+	}
+
+	if man = parseString(".SH NAME\nfoo\n"); man.Bugs != "" {
+		t.Errorf("Bugs: expected '', found '%s'\n", man.Bugs)
+	}
+
+	if man = parseString(mdoc_page); man.Bugs != "None." {
+		t.Errorf("Bugs: expected 'None.', found '%s'\n", man.Bugs)
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	man := parseString(".SH DESCRIPTION\nFirst paragraph,\nhard   wrapped.\n" +
+		".PP\nSecond\none.\n\nThird.\n.sp 2\nFourth.\n")
+	desc := "First paragraph, hard wrapped.\n\nSecond one.\n\nThird.\n\nFourth."
+	if man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+
+	man = parseString(".Dd January 1, 2020\n.Sh DESCRIPTION\nFirst\nparagraph.\n.Pp\nSecond.\n")
+	if desc = "First paragraph.\n\nSecond."; man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+}
+
+func TestOptDeprecated(t *testing.T) {
+	man := parseString(".SH OPTIONS\n.IP -a\n(deprecated) old behavior\n" +
+		".IP -b\nObsolete; use --bar instead.\n.IP -c\nreplaced by \\-\\-cee.\n" +
+		".IP -d\ncurrent\n.IP --cee\nthe new c\n" +
+		".IP -e\nto list hidden files use -a instead of naming them\n" +
+		".IP -f\nuse the config file instead\n.IP -g\nthe name is replaced by the path\n" +
+		".IP -h\nuse --cee instead of -h for speed\n.IP -i\nthis flag is not deprecated\n" +
+		".IP -j\nold form (use --cee instead)\n")
+	opts := []Opt{
+		{Name: "-a", Desc: "(deprecated) old behavior", Deprecated: true},
+		{Name: "-b", Desc: "Obsolete; use --bar instead.", Deprecated: true, Replacement: "--bar"},
+		{Name: "-c", Desc: "replaced by --cee.", Deprecated: true, Replacement: "--cee"},
+		{Name: "-d", Desc: "current"},
+		{Name: "--cee", Desc: "the new c"},
+		{Name: "-e", Desc: "to list hidden files use -a instead of naming them"},
+		{Name: "-f", Desc: "use the config file instead"},
+		{Name: "-g", Desc: "the name is replaced by the path"},
+		{Name: "-h", Desc: "use --cee instead of -h for speed"},
+		{Name: "-i", Desc: "this flag is not deprecated"},
+		{Name: "-j", Desc: "old form (use --cee instead)", Deprecated: true, Replacement: "--cee"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected %+v, found %+v\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestHeaderPreamble(t *testing.T) {
+	man := parseString(".\\\" Copyright (c) 2020\n.\\\" All rights reserved.\n\n" +
+		".ds Aq \\(aq\n.TH FOO\\& 8 \"2020-01-01\"\n.SH NAME\nfoo \\- does a thing\n" +
+		".SH EXAMPLES\n.TH BAR 1\n")
+	if man.Title != "FOO" || man.SectionNumber != "8" || man.Date != "2020-01-01" {
+		t.Errorf("Header: found '%s' '%s' '%s'\n", man.Title, man.SectionNumber, man.Date)
+	}
+}
+
+func TestClone(t *testing.T) {
+	man := parseString(library_page + ".SH OPTIONS\n.B -v, --verbose\nbe chatty\n")
+	c := man.Clone()
+	if !reflect.DeepEqual(man, c) {
+		t.Fatalf("Clone: expected %+v, found %+v\n", man, c)
+	}
+
+	c.Opts[0].Synonyms[0] = "--changed"
+	c.Opts[0].Desc = "changed"
+	c.Includes[0] = "changed.h"
+	c.Prototypes[0].Params[0] = "changed"
+	if man.Opts[0].Synonyms[0] != "--verbose" || man.Opts[0].Desc != "be chatty" ||
+		man.Includes[0] != "string.h" || man.Prototypes[0].Params[0] != "const char * s" {
+		t.Errorf("Clone: modifying the copy changed the original: %+v\n", man)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	man := parseString(library_page + ".SH OPTIONS\n.B -v, --verbose\nbe chatty\n.B -q\nbe quiet\n")
+	text, err := RoffSource{man}.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var round RoffSource
+	if err := round.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !man.Equal(round.Page) {
+		t.Errorf("Equal: expected the round trip %+v to equal %+v\n", round.Page, man)
+	}
+
+	c := man.Clone()
+	c.Opts[0], c.Opts[1] = c.Opts[1], c.Opts[0]
+	if !man.Equal(c) {
+		t.Errorf("Equal: expected reordered options to be equal\n")
+	}
+	c.Opts[0].Desc = "changed"
+	if man.Equal(c) || man.Equal(nil) {
+		t.Errorf("Equal: expected a changed option or nil page to differ\n")
+	}
+}
+
+func TestGob(t *testing.T) {
+	man, err := NewManPage("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(man); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ManPage
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !man.Equal(&decoded) || decoded.data != man.data {
+		t.Errorf("GobDecode: expected %+v, found %+v\n", man, decoded)
+	}
+}
+
+func TestIndexMacros(t *testing.T) {
+	man := parseString(".SH DESCRIPTION\n.IX Header \"DESCRIPTION\"\nDoes things.\n" +
+		".SH OPTIONS\n.IX Header \"OPTIONS\"\n.IP -q\n.IX Item \"-q\"\nbe quiet\n" +
+		".IX Item \"-v\"\n.IP -v\nbe chatty\n")
+	if man.Desc != "Does things." {
+		t.Errorf("Desc: expected 'Does things.', found '%s'\n", man.Desc)
+	}
+	opts := []Opt{
+		{Name: "-q", Desc: "be quiet"},
+		{Name: "-v", Desc: "be chatty"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestUnclosedNoFill(t *testing.T) {
+	man := parseString(".SH SYNOPSIS\n.nf\nfoo  [-q]\nfoo  -v\n" +
+		".SH DESCRIPTION\nDoes\nthings.\n.fi\n.SH OPTIONS\n.TP\n-q\nbe quiet\n")
+	if man.Synopsis != "foo  [-q]\nfoo  -v" {
+		t.Errorf("Synopsis: expected the preformatted lines, found '%s'\n", man.Synopsis)
+	}
+	if man.Desc != "Does things." {
+		t.Errorf("Desc: expected 'Does things.', found '%s'\n", man.Desc)
+	}
+	if len(man.Opts) != 1 || man.Opts[0].Name != "-q" {
+		t.Errorf("Opts: expected [-q], found %v\n", man.Opts)
+	}
+	warn := []string{`section "SYNOPSIS": .nf without a closing .fi`}
+	if !reflect.DeepEqual(man.Warnings, warn) {
+		t.Errorf("Warnings: expected %q, found %q\n", warn, man.Warnings)
+	}
+}
+
+func TestLayoutMacros(t *testing.T) {
+	man := parseString(".SH DESCRIPTION\n.ad l\n.nh\nDoes\n.na\nthings.\n" +
+		".SH OPTIONS\n.PD 0\n.TP\n-q\nbe quiet\n.hy 1\n.PD\n.ll 7i\n.TP\n-v\n" +
+		".in +4\nbe chatty\n")
+	if man.Desc != "Does things." {
+		t.Errorf("Desc: expected 'Does things.', found '%s'\n", man.Desc)
+	}
+	opts := []Opt{
+		{Name: "-q", Desc: "be quiet"},
+		{Name: "-v", Desc: "be chatty"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
+
+func TestUnknownRequests(t *testing.T) {
+	src := ".hw frob-nicate\n.SH DESCRIPTION\nDoes\n.zz 3\nthings.\n" +
+		".SH OPTIONS\n.TP\n-q\nbe\n.zz\nquiet\n.TP\n-v\nbe chatty\n"
+	man := parseString(src)
+	if man.Desc != "Does things." {
+		t.Errorf("Desc: expected 'Does things.', found '%s'\n", man.Desc)
+	}
+	if len(man.Opts) != 2 || man.Opts[0].Desc != "be quiet" {
+		t.Errorf("Opts: expected -q and -v, found %v\n", man.Opts)
+	}
+
+	IgnoreUnknownRequests = false
+	defer func() { IgnoreUnknownRequests = true }()
+	man = parseString(src)
+	if man.Desc != "Does .zz 3 things." {
+		t.Errorf("Desc: expected 'Does .zz 3 things.', found '%s'\n", man.Desc)
+	}
+}
+
+func TestMacroSpacing(t *testing.T) {
+	man := parseString(".  SH NAME\nfoo \\- spaced out\n.SH\tOPTIONS\n" +
+		".IP\t-q\nbe quiet\n.  IP -v\nbe chatty\n")
+	if man.Name != "foo" {
+		t.Errorf("Name: expected 'foo', found '%s'\n", man.Name)
+	}
+	opts := []Opt{
+		{Name: "-q", Desc: "be quiet"},
+		{Name: "-v", Desc: "be chatty"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+	for token, mt := range map[string]macro_type{
+		"SH": sh_macro, " .Tp ": tp_macro, "ip": ip_macro, ".XX": 0,
+	} {
+		if got := lookupMacro(token); got != mt {
+			t.Errorf("lookupMacro(%q): expected %d, found %d\n", token, mt, got)
+		}
+	}
+}
+
+const pod_page = `.IX Title "FOO 1"
+.TH FOO 1 "2020-01-01" "perl v5.30.0" "User Contributed Perl Documentation"
+.SH "NAME"
+foo \- a \*(C+ and Perl tool
+.SH "SYNOPSIS"
+.IX Header "SYNOPSIS"
+\&\fBfoo\fR [\-q]
+.SH "DESCRIPTION"
+.IX Header "DESCRIPTION"
+\&\fBfoo\fR reads \*(L"files\*(R".
+.PP
+.Vb 2
+\&  $ foo \-q
+\&    done
+.Ve
+.SH "OPTIONS"
+.IX Header "OPTIONS"
+.IP "\fB\-q\fR" 4
+.IX Item "-q"
+Be quiet.
+`
+
+func TestPodPage(t *testing.T) {
+	man := parseString(pod_page)
+	if man.Name != "foo" || man.Summary != "a C++ and Perl tool" {
+		t.Errorf("Name: found '%s' '%s'\n", man.Name, man.Summary)
+	}
+	if man.Synopsis != "foo [-q]" {
+		t.Errorf("Synopsis: expected 'foo [-q]', found '%s'\n", man.Synopsis)
+	}
+	desc := "foo reads \"files\".\n\n  $ foo -q\n    done"
+	if man.Desc != desc {
+		t.Errorf("Desc: expected '%s', found '%s'\n", desc, man.Desc)
+	}
+	opt := Opt{Name: "-q", Desc: "Be quiet."}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+}
+
+const diagnostics_page = `.TH FOO 1
+.SH NAME
+foo \- does a thing
+.SH OPTIONS
+.TP
+\-q
+be quiet
+.IP
+still quiet
+.SH DIAGNOSTICS
+The following messages may be issued:
+.TP
+foo: cannot open file
+The file does not exist.
+.TP
+.I "foo: out of memory"
+Buy more memory.
+.PP
+Or close programs.
+.SH BUGS
+None.
+`
+
+func TestSubcommands(t *testing.T) {
+	man := parseString(".SH NAME\nfoo \\- frobnicate\n.SH DESCRIPTION\n.TP\n" +
+		".B bar\nnot a subcommand\n.SH COMMANDS\n.TP\n\\fBadd\\fR [\\fIfile\\fR]\n" +
+		"Add a file.\n.TP\n.B rm\nRemove a file.\n.TP\n--all\nAll of them.\n" +
+		".SH OPTIONS\n.TP\n.B ls\nnot one either\n")
+	cmds := []Subcommand{{Name: "add", Desc: "Add a file."}, {Name: "rm", Desc: "Remove a file."}}
+	if !reflect.DeepEqual(man.Subcommands, cmds) {
+		t.Errorf("Subcommands: expected %v, found %v\n", cmds, man.Subcommands)
+	}
+
+	man = parseString(".SH NAME\nfoo \\- frobnicate\n.SH SUBCOMMANDS\nThe verbs are:\n" +
+		".SS \"add [file]\"\nAdd a\nfile.\n.PP\nOr two.\n.SS rm\nRemove a file.\n" +
+		".SH SEE ALSO\nbar(1)\n")
+	cmds = []Subcommand{{Name: "add", Desc: "Add a file.\n\nOr two."},
+		{Name: "rm", Desc: "Remove a file."}}
+	if !reflect.DeepEqual(man.Subcommands, cmds) {
+		t.Errorf("Subcommands: expected %v, found %v\n", cmds, man.Subcommands)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	man := parseString(diagnostics_page)
+	diags := []Diagnostic{
+		{Message: "foo: cannot open file", Meaning: "The file does not exist."},
+		{Message: "foo: out of memory", Meaning: "Buy more memory.\n\nOr close programs."},
+	}
+	if !reflect.DeepEqual(man.Diagnostics, diags) {
+		t.Errorf("Diagnostics: expected %v, found %v\n", diags, man.Diagnostics)
+	}
+
+	opt := Opt{Name: "-q", Desc: "be quiet\n\nstill quiet"}
+	if len(man.Opts) != 1 || !optEqual(man.Opts[0], opt) {
+		t.Errorf("Opts: expected [%s], found %v\n", opt, man.Opts)
+	}
+}
+
+func TestSectionAliases(t *testing.T) {
+	man := parseString(".SH NAME\nfoo \\- does a thing\n.SH OVERVIEW\nAn overview.\n")
+	if man.Desc != "An overview." {
+		t.Errorf("Desc: expected 'An overview.', found '%s'\n", man.Desc)
+	}
+
+	SectionAliases["DESCRIPTION"] = append(SectionAliases["DESCRIPTION"], "ABOUT")
+	defer func() {
+		aliases := SectionAliases["DESCRIPTION"]
+		SectionAliases["DESCRIPTION"] = aliases[:len(aliases)-1]
+	}()
+	man = parseString(".SH NAME\nfoo \\- does a thing\n.SH ABOUT\nAbout foo.\n")
+	if man.Desc != "About foo." {
+		t.Errorf("Desc: expected 'About foo.', found '%s'\n", man.Desc)
+	}
+}
+
+func TestPlusOptions(t *testing.T) {
+	src := ".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH OPTIONS\n.TP\n+x\nenable x\n.TP\n" +
+		"\\fB+\\fIN\\fR\nstart at line N\n.TP\na\nall users\n.TP\n\\-q\nbe quiet\n" +
+		".SH DESCRIPTION\n.TP\nb\nnot an option\n"
+	man := parseString(src)
+	opts := []Opt{
+		{Name: "+x", Desc: "enable x"},
+		{Name: "+N", Desc: "start at line N"},
+		{Name: "a", Desc: "all users"},
+		{Name: "-q", Desc: "be quiet"},
+	}
+	if len(man.Opts) != len(opts) {
+		t.Fatalf("Opts: expected %v, found %v\n", opts, man.Opts)
+	}
+	for i, opt := range opts {
+		if !optEqual(man.Opts[i], opt) {
+			t.Errorf("Opts: expected '%s', found '%s'\n", opt, man.Opts[i])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// http - Serving parsed man pages over HTTP.
+package goman
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+type handler struct {
+	set *ManPageSet
+}
+
+// Handler returns an http.Handler serving the man tree rooted at 'root' as
+// HTML.  Request paths name a section directory and page, e.g. /man1/ls.
+// Parsed pages are cached so repeated requests are not re-parsed.
+func Handler(root string) http.Handler {
+	return &handler{set: NewManPageSet(root)}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(path.Clean(r.URL.Path), "/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	man, err := h.set.Lookup(parts[0], parts[1])
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, man.ToHTML())
+}
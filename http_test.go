@@ -0,0 +1,58 @@
+package goman
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	root := t.TempDir()
+	data, err := ioutil.ReadFile("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "man1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "man1", "foobar.1.gz"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(root))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/man1/foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Handler: expected status 200, found %d\n", resp.StatusCode)
+	}
+	ctype := "text/html; charset=utf-8"
+	if resp.Header.Get("Content-Type") != ctype {
+		t.Errorf("Handler: expected '%s', found '%s'\n", ctype, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "<h1>foobar</h1>") {
+		t.Errorf("Handler: page is missing its title: %s\n", body)
+	}
+
+	for _, path := range []string{"/man1/missing", "/man1/../foobar", "/foobar",
+		"/man1/*", "/man1/[", "/man*/foobar"} {
+		resp, err = http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Handler: expected status 404 for %s, found %d\n", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// include - Resolution of .so requests that redirect to other man pages.
+package goman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IncludeResolution selects how pages that are just a .so redirect to
+// another page are handled.  The constants are prefixed as None already names
+// an uncompressed Compression.
+type IncludeResolution int
+
+const (
+	// Parse the page redirected to in place of the redirect
+	IncludeEager IncludeResolution = iota
+	// Record the target in 'Redirect' without loading it
+	IncludeLazy
+	// Parse the redirect as a page of its own
+	IncludeNone
+)
+
+// WithIncludeResolution selects how .so redirects are handled, following them
+// as they are parsed by default.  Either way a redirect page records its
+// target, as written, in the page's 'Redirect' field unless 'mode' is
+// IncludeNone.
+func WithIncludeResolution(mode IncludeResolution) ParseOption {
+	return func(m *ManPage) {
+		m.includes = mode
+	}
+}
+
+// The number of .so redirects followed by default before giving up
+const default_include_depth = 8
+
+// WithMaxIncludeDepth limits the chain of .so redirects followed from a page
+// to 'n' redirects, beyond which parsing fails with a *ParseError.  Depths
+// that are not positive select the default of 8.
+func WithMaxIncludeDepth(n int) ParseOption {
+	return func(m *ManPage) {
+		m.includeDepth = n
+	}
+}
+
+// Return the target of a page that consists of a single .so request.  A
+// page that goes on past the request, e.g. one sourcing its macros before
+// its own text, is no redirect.
+func soTarget(data string) (string, bool) {
+	target, found := "", false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || isComment(line) {
+			continue
+		}
+		if found || !strings.HasPrefix(line, ".") || macroName(line) != "so" {
+			return "", false
+		}
+		args := roffArgs(macroArgs(line))
+		if len(args) == 0 {
+			return "", false
+		}
+		target, found = args[0], true
+	}
+	return target, found
+}
+
+// Return the root of the man tree holding 'path', i.e. the directory above
+// its manN section directory.  Pages outside of a man tree are rooted at
+// their own directory.
+func manRoot(path string) string {
+	dir := filepath.Dir(path)
+	if sectdir_re.MatchString(filepath.Base(dir)) {
+		return filepath.Dir(dir)
+	}
+	return dir
+}
+
+// Locate the file a .so request in the page 'path' refers to.  Targets are
+// relative to the root of the man tree, and may or may not carry the .gz
+// suffix of the file they name.
+func resolveSo(path, target string) (string, error) {
+	var candidates []string
+	if filepath.IsAbs(target) {
+		candidates = []string{target}
+	} else {
+		candidates = []string{
+			filepath.Join(manRoot(path), target),
+			filepath.Join(filepath.Dir(path), target),
+		}
+	}
+
+	for _, cand := range candidates {
+		alt := cand + ".gz"
+		if strings.HasSuffix(cand, ".gz") {
+			alt = strings.TrimSuffix(cand, ".gz")
+		}
+		for _, file := range []string{cand, alt} {
+			if st, err := os.Stat(file); err == nil && !st.IsDir() {
+				return file, nil
+			}
+		}
+	}
+	return "", &ParseError{errmsg: "missing .so target " + target + " in " + path}
+}
+
+// Follow the .so redirects starting at the page 'path' holding 'data',
+// returning the source of the page finally redirected to.  At most 'depth'
+// redirects are followed.
+func resolveIncludes(path, data string, depth int) (string, error) {
+	if depth <= 0 {
+		depth = default_include_depth
+	}
+	seen := map[string]bool{filepath.Clean(path): true}
+	for n := 0; ; n++ {
+		target, ok := soTarget(data)
+		if !ok {
+			return data, nil
+		}
+		if n == depth {
+			return "", &ParseError{errmsg: fmt.Sprintf(
+				"more than %d .so redirects from %s", depth, path)}
+		}
+
+		next, err := resolveSo(path, target)
+		if err != nil {
+			return "", err
+		}
+		if seen[filepath.Clean(next)] {
+			return "", &ParseError{errmsg: "cycle in .so redirects at " + next}
+		}
+		seen[filepath.Clean(next)] = true
+
+		if data, err = readManFile(next); err != nil {
+			return "", err
+		}
+		path = next
+	}
+}
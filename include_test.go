@@ -0,0 +1,131 @@
+package goman
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write a man tree of uncompressed pages given as path/content pairs
+func writeTree(t *testing.T, pages map[string]string) string {
+	root := t.TempDir()
+	for path, data := range pages {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestSoIncludes(t *testing.T) {
+	data, err := ioutil.ReadFile("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := writeTree(t, map[string]string{
+		"man1/alias.1":  ".\\\" redirect\n.so man1/../man8/target.8\n",
+		"man8/target.8": string(data),
+		"man1/loop.1":   ".so man1/loop2.1\n",
+		"man1/loop2.1":  ".so man1/loop.1\n",
+		"man1/gone.1":   ".so man1/missing.1\n",
+		"man1/tmac.1": ".so man1/missing.tmac\n.TH TMAC 1\n.SH NAME\ntmac \\- own text\n" +
+			".SH DESCRIPTION\ntext\n",
+	})
+	if err := os.Rename(filepath.Join(root, "man8/target.8"),
+		filepath.Join(root, "man8/target.8.gz")); err != nil {
+		t.Fatal(err)
+	}
+
+	man, err := NewManPage(filepath.Join(root, "man1/alias.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Name != "foobar" {
+		t.Errorf("Name: expected 'foobar', found '%s'\n", man.Name)
+	}
+
+	// Sourcing macros ahead of its own text does not make a page a redirect
+	man, err = NewManPage(filepath.Join(root, "man1/tmac.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Name != "tmac" || man.Redirect != "" || man.IsStub() {
+		t.Errorf("NewManPage: expected the page's own text, found '%s' '%s'\n", man.Name, man.Redirect)
+	}
+
+	for _, page := range []string{"man1/loop.1", "man1/gone.1"} {
+		var perr *ParseError
+		_, err := NewManPage(filepath.Join(root, page))
+		if !errors.As(err, &perr) {
+			t.Errorf("NewManPage: expected a *ParseError for %s, found %v\n", page, err)
+		}
+	}
+}
+
+func TestIncludeResolution(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"man1/alias.1":  ".so man8/target.8\n",
+		"man8/target.8": ".TH TARGET 8\n.SH NAME\ntarget \\- does things\n",
+		"man1/gone.1":   ".so man1/missing.1\n",
+	})
+	alias := filepath.Join(root, "man1/alias.1")
+
+	tests := []struct {
+		mode           IncludeResolution
+		name, redirect string
+	}{
+		{IncludeEager, "target", "man8/target.8"},
+		{IncludeLazy, "", "man8/target.8"},
+		{IncludeNone, "", ""},
+	}
+	for _, test := range tests {
+		man, err := NewManPage(alias, WithIncludeResolution(test.mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if man.Name != test.name || man.Redirect != test.redirect {
+			t.Errorf("WithIncludeResolution(%d): expected '%s' '%s', found '%s' '%s'\n",
+				test.mode, test.name, test.redirect, man.Name, man.Redirect)
+		}
+	}
+
+	// Targets are not loaded, so missing ones are no error
+	man, err := NewManPage(filepath.Join(root, "man1/gone.1"), WithIncludeResolution(IncludeLazy))
+	if err != nil || man.Redirect != "man1/missing.1" {
+		t.Errorf("WithIncludeResolution(IncludeLazy): expected 'man1/missing.1', found '%v' %v\n",
+			man, err)
+	}
+}
+
+func TestMaxIncludeDepth(t *testing.T) {
+	pages := map[string]string{"man1/p9.1": ".TH P9 1\n.SH NAME\np9 \\- the end\n"}
+	for i := 0; i < 9; i++ {
+		pages[fmt.Sprintf("man1/p%d.1", i)] = fmt.Sprintf(".so man1/p%d.1\n", i+1)
+	}
+	root := writeTree(t, pages)
+
+	// Nine redirects lead from p0 to p9, one more than are followed by default
+	var perr *ParseError
+	if _, err := NewManPage(filepath.Join(root, "man1/p0.1")); !errors.As(err, &perr) {
+		t.Errorf("NewManPage: expected a *ParseError, found %v\n", err)
+	}
+	if man, err := NewManPage(filepath.Join(root, "man1/p1.1")); err != nil || man.Name != "p9" {
+		t.Errorf("NewManPage: expected 'p9', found '%v' %v\n", man, err)
+	}
+	if man, err := NewManPage(filepath.Join(root, "man1/p0.1"), WithMaxIncludeDepth(9)); err != nil || man.Name != "p9" {
+		t.Errorf("WithMaxIncludeDepth(9): expected 'p9', found '%v' %v\n", man, err)
+	}
+	if _, err := NewManPage(filepath.Join(root, "man1/p8.1"), WithMaxIncludeDepth(1)); err != nil {
+		t.Errorf("WithMaxIncludeDepth(1): expected no error, found %v\n", err)
+	}
+	if _, err := NewManPage(filepath.Join(root, "man1/p7.1"), WithMaxIncludeDepth(1)); !errors.As(err, &perr) {
+		t.Errorf("WithMaxIncludeDepth(1): expected a *ParseError, found %v\n", err)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// index - Full-text search across the man pages of a man tree.
+package goman
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A page matching a search, and how often the searched words occur in it
+type SearchResult struct {
+	Page  *ManPage
+	Score int
+}
+
+// Index is an inverted index of the NAME, DESCRIPTION and option text of the
+// pages of a ManPageSet, for apropos(1) style searches.  It is not changed
+// once built, so it is safe for concurrent queries.
+type Index struct {
+	pages    []*ManPage
+	postings map[string]map[int]int
+	stats    ParseStats
+}
+
+// Split 'text' into lower-case words of letters and digits, so "--no-color"
+// gives "no" and "color"
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// Index builds the search index of every page of the set's man tree, parsing
+// the pages not already cached using up to 'concurrency' workers, or one per
+// CPU if 'concurrency' is not positive.  Pages that fail to parse are left
+// out, and their errors are returned alongside the index.
+func (s *ManPageSet) Index(concurrency int) (*Index, []error) {
+	paths, err := findManFiles(s.Root)
+	if err != nil {
+		return nil, []error{fmt.Errorf("error walking %s: %w", s.Root, err)}
+	}
+	pages, errs := parseFiles(paths, concurrency, s.load)
+
+	idx := &Index{postings: make(map[string]map[int]int)}
+	var indexed []*ManPage
+	var failed []error
+	for i, man := range pages {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		idx.add(man)
+		indexed = append(indexed, man)
+	}
+	idx.stats.add(indexed, failed)
+	return idx, failed
+}
+
+// Stats returns the counts of the pages parsed for the index, those that
+// failed and those with authoring mistakes.
+func (idx *Index) Stats() ParseStats {
+	stats := idx.stats
+	stats.Warnings = make(map[WarningKind]int)
+	for kind, n := range idx.stats.Warnings {
+		stats.Warnings[kind] = n
+	}
+	return stats
+}
+
+// Add the words of the page's name, description and options to the index
+func (idx *Index) add(man *ManPage) {
+	id := len(idx.pages)
+	idx.pages = append(idx.pages, man)
+
+	text := []string{man.Name, man.Summary, man.Desc}
+	for _, opt := range man.Opts {
+		text = append(text, opt.Name, opt.Desc)
+		text = append(text, opt.Synonyms...)
+	}
+	for _, word := range tokenize(strings.Join(text, " ")) {
+		if idx.postings[word] == nil {
+			idx.postings[word] = make(map[int]int)
+		}
+		idx.postings[word][id]++
+	}
+}
+
+// Query returns the pages holding every word of 'term', the most frequent
+// matches first and otherwise ordered by name and path.
+func (idx *Index) Query(term string) []SearchResult {
+	words := tokenize(term)
+	if len(words) == 0 {
+		return nil
+	}
+
+	scores := make(map[int]int)
+	for id, n := range idx.postings[words[0]] {
+		scores[id] = n
+	}
+	for _, word := range words[1:] {
+		postings := idx.postings[word]
+		for id := range scores {
+			if n, ok := postings[id]; ok {
+				scores[id] += n
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, SearchResult{Page: idx.pages[id], Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Page.Name != b.Page.Name {
+			return a.Page.Name < b.Page.Name
+		}
+		return a.Page.Path < b.Page.Path
+	})
+	return results
+}
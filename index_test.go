@@ -0,0 +1,37 @@
+package goman
+
+import (
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"man1/cp.1": ".TH CP 1\n.SH NAME\ncp \\- copy files\n" +
+			".SH DESCRIPTION\nCopy a file to another file.\n" +
+			".SH OPTIONS\n.TP\n.B \\-r\ncopy directories recursively\n",
+		"man1/mv.1":     ".TH MV 1\n.SH NAME\nmv \\- move files\n.SH DESCRIPTION\nRename a file.\n",
+		"man1/broken.1": ".so man1/missing.1\n",
+	})
+
+	idx, errs := NewManPageSet(root).Index(2)
+	if len(errs) != 1 {
+		t.Errorf("Index: expected 1 error, found %v\n", errs)
+	}
+	if stats := idx.Stats(); stats.Parsed != 2 || stats.Failed != 1 {
+		t.Errorf("Stats: expected 2 parsed and 1 failed, found %+v\n", stats)
+	}
+
+	results := idx.Query("File")
+	if len(results) != 2 || results[0].Page.Name != "cp" || results[1].Page.Name != "mv" {
+		t.Errorf("Query: expected [cp mv], found %v\n", results)
+	} else if results[0].Score <= results[1].Score {
+		t.Errorf("Query: expected cp to score higher, found %d and %d\n",
+			results[0].Score, results[1].Score)
+	}
+	if results = idx.Query("copy recursively"); len(results) != 1 || results[0].Page.Name != "cp" {
+		t.Errorf("Query: expected [cp], found %v\n", results)
+	}
+	if results = idx.Query("move directories"); len(results) != 0 {
+		t.Errorf("Query: expected no results, found %v\n", results)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// keywords - Topical keywords of a page, as listed or as derived from its text.
+package goman
+
+import (
+	"sort"
+	"strings"
+)
+
+// Common words that say nothing of what a page is about
+var stop_words = map[string]bool{
+	"also": true, "and": true, "any": true, "are": true, "been": true,
+	"but": true, "can": true, "does": true, "each": true, "for": true,
+	"from": true, "has": true, "have": true, "into": true, "its": true,
+	"may": true, "more": true, "not": true, "one": true, "only": true,
+	"or": true, "other": true, "such": true, "than": true, "that": true,
+	"the": true, "their": true, "then": true, "there": true, "these": true,
+	"this": true, "used": true, "uses": true, "using": true, "when": true,
+	"which": true, "will": true, "with": true, "would": true, "you": true,
+}
+
+// Split the KEYWORDS section into the keywords it lists, separated by commas
+// or, when there are none, by blanks
+func (m *ManPage) parseKeywords() {
+	text, _ := m.aliasedSection("KEYWORDS")
+	split := func(r rune) bool { return r == ',' || r == ';' || r == '\n' }
+	if !strings.ContainsAny(text, ",;") {
+		split = func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' }
+	}
+	for _, word := range strings.FieldsFunc(text, split) {
+		if word = strings.TrimSuffix(strings.TrimSpace(word), "."); word != "" {
+			m.Keywords = append(m.Keywords, word)
+		}
+	}
+}
+
+// DeriveKeywords returns up to 'n' keywords for the page: those listed by its
+// KEYWORDS section if it has one, or else the words used most often by its
+// NAME and DESCRIPTION sections, leaving out the page's own name and common
+// words.  An 'n' of zero or less places no limit on the number returned.
+func (m *ManPage) DeriveKeywords(n int) []string {
+	if len(m.Keywords) > 0 {
+		if n > 0 && len(m.Keywords) > n {
+			return copyStrings(m.Keywords[:n])
+		}
+		return copyStrings(m.Keywords)
+	}
+
+	counts := make(map[string]int)
+	for _, word := range tokenize(m.Summary + " " + m.Desc) {
+		if len(word) > 2 && !stop_words[word] && word != strings.ToLower(m.Name) &&
+			strings.Trim(word, "0123456789") != "" {
+			counts[word]++
+		}
+	}
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if n > 0 && len(words) > n {
+		words = words[:n]
+	}
+	return words
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// library - Extraction of the C interface documented by library man pages.
+package goman
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A C function prototype from the SYNOPSIS of a library man page.
+type Prototype struct {
+	ReturnType string
+	Name       string
+	Params     []string
+}
+
+var include_re = regexp.MustCompile(`#\s*include\s*[<"]([^>"]+)[>"]`)
+var prototype_re = regexp.MustCompile(`^([^(]*[\s*])(\w+)\s*\((.*)\)$`)
+
+// Report whether the page documents a C interface, i.e. system calls or
+// library functions.
+func (m *ManPage) isLibrary() bool {
+	for _, sect := range []string{m.SectionNumber, m.FileSection} {
+		if strings.HasPrefix(sect, "2") || strings.HasPrefix(sect, "3") {
+			return true
+		}
+	}
+	return false
+}
+
+// Split a parameter list on the commas that are not nested in parentheses,
+// as found in function pointer parameters.
+func splitParams(params string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, c := range params {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				out = append(out, strings.TrimSpace(params[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(params[start:]); last != "" && last != "void" {
+		out = append(out, last)
+	}
+	return out
+}
+
+// Parse a single C declaration into a prototype, or nil if it is not a
+// function.
+func parsePrototype(decl string) *Prototype {
+	decl = strings.Join(strings.Fields(decl), " ")
+	match := prototype_re.FindStringSubmatch(decl)
+	if match == nil || strings.TrimSpace(match[1]) == "" {
+		return nil
+	}
+	return &Prototype{
+		ReturnType: strings.TrimSpace(match[1]),
+		Name:       match[2],
+		Params:     splitParams(match[3]),
+	}
+}
+
+// Parse the #include lines and function prototypes from the SYNOPSIS of
+// library pages
+func (m *ManPage) parsePrototypes() {
+	if !m.isLibrary() {
+		return
+	}
+	synopsis, ok := m.cleanSection("SYNOPSIS")
+	if !ok {
+		return
+	}
+
+	synopsis = strings.ReplaceAll(synopsis, `"`, "")
+	for _, match := range include_re.FindAllStringSubmatch(synopsis, -1) {
+		m.Includes = append(m.Includes, match[1])
+	}
+	synopsis = include_re.ReplaceAllString(synopsis, "")
+
+	for _, decl := range strings.Split(synopsis, ";") {
+		if proto := parsePrototype(decl); proto != nil {
+			m.Prototypes = append(m.Prototypes, *proto)
+		}
+	}
+}
+
+// Parse the headers and function prototypes from the SYNOPSIS of mdoc library
+// pages.  Functions are declared with .Fn, or over several lines with .Fo,
+// .Fa and .Fc, and take their return type from the .Ft before them.
+func (m *ManPage) parseMdocPrototypes() {
+	if !m.isLibrary() {
+		return
+	}
+	lines, ok := m.mdocSection("SYNOPSIS")
+	if !ok {
+		return
+	}
+
+	var proto *Prototype
+	rettype := ""
+	param := func(arg string) {
+		if arg = strings.Join(strings.Fields(stripEscapes(arg)), " "); arg != "" && arg != "void" {
+			proto.Params = append(proto.Params, arg)
+		}
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, ".") {
+			continue
+		}
+		args := roffArgs(macroArgs(line))
+		switch macroName(line) {
+		case "In":
+			if len(args) > 0 {
+				m.Includes = append(m.Includes, args[0])
+			}
+		case "Fd":
+			if match := include_re.FindStringSubmatch(macroArgs(line)); match != nil {
+				m.Includes = append(m.Includes, match[1])
+			}
+		case "Ft":
+			rettype = stripEscapes(strings.Join(args, " "))
+		case "Fn", "Fo":
+			if len(args) == 0 {
+				break
+			}
+			proto = &Prototype{ReturnType: rettype, Name: args[0]}
+			if macroName(line) == "Fo" {
+				break
+			}
+			for _, arg := range args[1:] {
+				if len(arg) == 1 && strings.Contains(".,:;)]?!", arg) {
+					break
+				}
+				param(arg)
+			}
+			fallthrough
+		case "Fc":
+			if proto != nil {
+				m.Prototypes = append(m.Prototypes, *proto)
+			}
+			proto, rettype = nil, ""
+		case "Fa":
+			if proto != nil {
+				for _, arg := range args {
+					param(arg)
+				}
+			}
+		}
+	}
+}
+
+func (m *ManPage) parseReturnValue() {
+	m.ReturnValue, _ = m.aliasedSection("RETURN VALUE")
+}
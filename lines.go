@@ -0,0 +1,78 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// lines - Iteration over the classified lines of a page's roff source.
+package goman
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+)
+
+// LineKind classifies a line of roff source.
+type LineKind int
+
+const (
+	LineText LineKind = iota
+	LineMacro
+	LineComment
+	LineBlank
+)
+
+var line_kind_names = map[LineKind]string{
+	LineText:    "text",
+	LineMacro:   "macro",
+	LineComment: "comment",
+	LineBlank:   "blank",
+}
+
+func (k LineKind) String() string {
+	if name, ok := line_kind_names[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("LineKind(%d)", int(k))
+}
+
+// Line is a logical line of roff source, with any lines continued onto it by
+// a trailing backslash joined.  'Number' is the line it starts on in the
+// source as normalized for parsing, counting from one.  'Macro' and 'Args'
+// are the name and arguments of a macro or request line, e.g. "TP" or "nf".
+type Line struct {
+	Kind   LineKind
+	Number int
+	Text   string
+	Macro  string
+	Args   []string
+}
+
+// Lines yields each logical line of the page's roff source, classified as
+// macro, text, comment or blank.  Blocks ignored with .ig have already been
+// removed from the source, and most continued lines joined.
+func (m *ManPage) Lines() iter.Seq[Line] {
+	return func(yield func(Line) bool) {
+		lines := strings.Split(strings.TrimSuffix(m.data, "\n"), "\n")
+		for i := 0; i < len(lines); i++ {
+			l := Line{Number: i + 1, Text: lines[i]}
+			for isContinued(l.Text) && i+1 < len(lines) {
+				i++
+				l.Text = l.Text[:len(l.Text)-1] + lines[i]
+			}
+
+			switch {
+			case isComment(l.Text):
+				l.Kind = LineComment
+			case strings.TrimSpace(l.Text) == "":
+				l.Kind = LineBlank
+			case strings.HasPrefix(l.Text, ".") || strings.HasPrefix(l.Text, "'"):
+				l.Kind = LineMacro
+				l.Macro = macroName("." + l.Text[1:])
+				l.Args = roffArgs(macroArgs("." + l.Text[1:]))
+			}
+			if !yield(l) {
+				return
+			}
+		}
+	}
+}
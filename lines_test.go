@@ -0,0 +1,37 @@
+package goman
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	man := parseString(".\\\" comment\n.TH FOO 1\n\n.SH \"SEE ALSO\"\nbar(1), \\\nbaz(1)\nend\n")
+	lines := []Line{
+		{Kind: LineComment, Number: 1, Text: ".\\\" comment"},
+		{Kind: LineMacro, Number: 2, Text: ".TH FOO 1", Macro: "TH", Args: []string{"FOO", "1"}},
+		{Kind: LineBlank, Number: 3},
+		{Kind: LineMacro, Number: 4, Text: ".SH \"SEE ALSO\"", Macro: "SH",
+			Args: []string{"SEE ALSO"}},
+		{Kind: LineText, Number: 5, Text: "bar(1), baz(1)"},
+		{Kind: LineText, Number: 6, Text: "end"},
+	}
+	var found []Line
+	for line := range man.Lines() {
+		found = append(found, line)
+	}
+	if !reflect.DeepEqual(found, lines) {
+		t.Errorf("Lines: expected %v, found %v\n", lines, found)
+	}
+
+	// Stopping early ends the iteration
+	n := 0
+	for range man.Lines() {
+		if n++; n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Errorf("Lines: expected to stop after 2 lines, found %d\n", n)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// lz4 - Decompression of man pages in the LZ4 frame format.
+package goman
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/bits"
+)
+
+const lz4_magic = 0x184d2204
+
+// Flags of the LZ4 frame descriptor
+const (
+	lz4_version        = 0x40
+	lz4_block_checksum = 0x10
+	lz4_content_size   = 0x08
+	lz4_content_check  = 0x04
+	lz4_dict_id        = 0x01
+)
+
+var errLZ4 = errors.New("corrupt lz4 stream")
+
+const (
+	xxh_prime1 uint32 = 2654435761
+	xxh_prime2 uint32 = 2246822519
+	xxh_prime3 uint32 = 3266489917
+	xxh_prime4 uint32 = 668265263
+	xxh_prime5 uint32 = 374761393
+)
+
+// Return the 32-bit xxHash of 'b', which LZ4 frames use as their checksum
+func xxh32(b []byte, seed uint32) uint32 {
+	round := func(acc, in uint32) uint32 {
+		return bits.RotateLeft32(acc+in*xxh_prime2, 13) * xxh_prime1
+	}
+
+	n := len(b)
+	var h uint32
+	if len(b) >= 16 {
+		v := [4]uint32{seed + xxh_prime1 + xxh_prime2, seed + xxh_prime2, seed, seed - xxh_prime1}
+		for ; len(b) >= 16; b = b[16:] {
+			for i := range v {
+				v[i] = round(v[i], binary.LittleEndian.Uint32(b[4*i:]))
+			}
+		}
+		h = bits.RotateLeft32(v[0], 1) + bits.RotateLeft32(v[1], 7) +
+			bits.RotateLeft32(v[2], 12) + bits.RotateLeft32(v[3], 18)
+	} else {
+		h = seed + xxh_prime5
+	}
+	h += uint32(n)
+
+	for ; len(b) >= 4; b = b[4:] {
+		h = bits.RotateLeft32(h+binary.LittleEndian.Uint32(b)*xxh_prime3, 17) * xxh_prime4
+	}
+	for _, c := range b {
+		h = bits.RotateLeft32(h+uint32(c)*xxh_prime5, 11) * xxh_prime1
+	}
+	h ^= h >> 15
+	h *= xxh_prime2
+	h ^= h >> 13
+	h *= xxh_prime3
+	h ^= h >> 16
+	return h
+}
+
+// Decompress the LZ4 frames read from 'r'.  The pages are small, so the
+// whole of the output is kept, which also serves as the history blocks may
+// refer back to.
+func readLZ4(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	for len(data) > 0 {
+		if out, data, err = readLZ4Frame(out, data); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Decompress the LZ4 frame leading 'data' onto 'out', returning the output
+// and the data following the frame.
+func readLZ4Frame(out, data []byte) ([]byte, []byte, error) {
+	if len(data) < 7 || binary.LittleEndian.Uint32(data) != lz4_magic {
+		return nil, nil, errLZ4
+	}
+	flags := data[4]
+	if flags&0xc0 != lz4_version {
+		return nil, nil, errors.New("unsupported lz4 frame version")
+	}
+	if flags&lz4_dict_id != 0 {
+		return nil, nil, errors.New("unsupported lz4 dictionary")
+	}
+	desc := 2
+	if flags&lz4_content_size != 0 {
+		desc += 8
+	}
+	if len(data) < 4+desc+1 {
+		return nil, nil, errLZ4
+	}
+	if byte(xxh32(data[4:4+desc], 0)>>8) != data[4+desc] {
+		return nil, nil, errors.New("lz4 frame header checksum mismatch")
+	}
+	data = data[4+desc+1:]
+
+	start := len(out)
+	for {
+		if len(data) < 4 {
+			return nil, nil, errLZ4
+		}
+		size := binary.LittleEndian.Uint32(data)
+		data = data[4:]
+		if size == 0 {
+			break
+		}
+		raw := size&0x80000000 != 0
+		size &^= 0x80000000
+		if uint64(size) > uint64(len(data)) {
+			return nil, nil, errLZ4
+		}
+		block := data[:size]
+		data = data[size:]
+		if flags&lz4_block_checksum != 0 {
+			if len(data) < 4 {
+				return nil, nil, errLZ4
+			}
+			data = data[4:]
+		}
+
+		var err error
+		if raw {
+			out = append(out, block...)
+		} else if out, err = readLZ4Block(out, block); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if flags&lz4_content_check != 0 {
+		if len(data) < 4 {
+			return nil, nil, errLZ4
+		}
+		if xxh32(out[start:], 0) != binary.LittleEndian.Uint32(data) {
+			return nil, nil, errors.New("lz4 content checksum mismatch")
+		}
+		data = data[4:]
+	}
+	return out, data, nil
+}
+
+// Decompress the LZ4 block 'src' onto 'out'.  Each sequence is a run of
+// literals followed by a copy of earlier output, except for the last which
+// only has literals.
+func readLZ4Block(out, src []byte) ([]byte, error) {
+	// Lengths of 15 continue in the following bytes
+	length := func(n int) (int, bool) {
+		if n != 15 {
+			return n, true
+		}
+		for len(src) > 0 {
+			b := src[0]
+			src = src[1:]
+			n += int(b)
+			if b != 255 {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+
+	for len(src) > 0 {
+		token := src[0]
+		src = src[1:]
+
+		lits, ok := length(int(token >> 4))
+		if !ok || lits > len(src) {
+			return nil, errLZ4
+		}
+		out = append(out, src[:lits]...)
+		src = src[lits:]
+		if len(src) == 0 {
+			break
+		}
+
+		if len(src) < 2 {
+			return nil, errLZ4
+		}
+		offset := int(binary.LittleEndian.Uint16(src))
+		src = src[2:]
+		n, ok := length(int(token & 15))
+		if !ok || offset == 0 || offset > len(out) {
+			return nil, errLZ4
+		}
+
+		// The copy may overlap the bytes it produces
+		pos := len(out) - offset
+		for i := 0; i < n+4; i++ {
+			out = append(out, out[pos+i])
+		}
+	}
+	return out, nil
+}
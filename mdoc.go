@@ -0,0 +1,416 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// mdoc - Parsing of BSD mdoc(7) formatted man pages.
+package goman
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Macros that only appear in mdoc documents
+var mdoc_re = regexp.MustCompilePOSIX(`^\.(Dd|Os|Sh|Nm)([ \t]|$)`)
+
+// mdoc macros that only structure the document and carry no text
+var mdoc_block_macros = map[string]bool{
+	"Bd": true, "Bl": true, "Dd": true, "Dt": true, "Ed": true,
+	"El": true, "Os": true, "Pp": true, "Sh": true, "Ss": true,
+}
+
+// mdoc macros that may appear as arguments of other macros
+var mdoc_callable_macros = map[string]bool{
+	"Ad": true, "An": true, "Aq": true, "Ar": true, "Bq": true,
+	"Cm": true, "Dq": true, "Dv": true, "Em": true, "Er": true,
+	"Ev": true, "Fa": true, "Fl": true, "Fn": true, "Ic": true,
+	"Li": true, "Nm": true, "Ns": true, "Oc": true, "Oo": true,
+	"Op": true, "Pa": true, "Pq": true, "Ql": true, "Qq": true,
+	"Sq": true, "Sx": true, "Sy": true, "Va": true, "Xr": true,
+}
+
+// mdoc quoting macros and the delimiters they enclose their arguments in
+var mdoc_enclosures = map[string][2]string{
+	"Aq": {"<", ">"},
+	"Bq": {"[", "]"},
+	"Dq": {"\"", "\""},
+	"Op": {"[", "]"},
+	"Pq": {"(", ")"},
+	"Ql": {"'", "'"},
+	"Qq": {"\"", "\""},
+	"Sq": {"'", "'"},
+}
+
+// Report whether 'data' is written using the mdoc macro package.
+func isMdoc(data string) bool {
+	return mdoc_re.MatchString(data)
+}
+
+// Translate a single line of an mdoc document into plain text.  'name' is
+// substituted for argument-less .Nm macros.
+func mdocText(line, name string) string {
+	if !strings.HasPrefix(line, ".") {
+		return stripEscapes(line)
+	}
+	args := roffArgs(line[1:])
+	if len(args) == 0 || strings.HasPrefix(args[0], `\"`) ||
+		mdoc_block_macros[args[0]] {
+		return ""
+	}
+	if args[0] == "It" || args[0] == "Nd" {
+		args = args[1:]
+	}
+
+	var words, closers []string
+	dash, nospace := false, false
+	emit := func(word string) {
+		if dash {
+			word = "-" + word
+			dash = false
+		}
+		if nospace && len(words) > 0 {
+			words[len(words)-1] += word
+		} else {
+			words = append(words, word)
+		}
+		nospace = false
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !mdoc_callable_macros[arg] {
+			// Trailing punctuation attaches to the preceding word
+			if len(arg) == 1 && strings.Contains(".,:;)]?!", arg) {
+				nospace = true
+			}
+			emit(arg)
+			continue
+		}
+		if dash {
+			emit("")
+		}
+		switch arg {
+		case "Fl":
+			dash = true
+		case "Ns":
+			nospace = true
+		case "Oo":
+			emit("[")
+			nospace = true
+		case "Oc":
+			nospace = true
+			emit("]")
+		case "Nm":
+			if i+1 == len(args) || mdoc_callable_macros[args[i+1]] {
+				emit(name)
+			}
+		case "Xr":
+			if i+2 < len(args) {
+				emit(args[i+1] + "(" + args[i+2] + ")")
+				i += 2
+			}
+		default:
+			if enc, ok := mdoc_enclosures[arg]; ok {
+				emit(enc[0])
+				nospace = true
+				closers = append(closers, enc[1])
+			}
+		}
+	}
+	if dash {
+		emit("")
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		nospace = true
+		emit(closers[i])
+	}
+	return stripEscapes(strings.Join(words, " "))
+}
+
+// Return the lines of the mdoc section named 'name', and whether the section
+// exists.
+func (m *ManPage) mdocSection(name string) ([]string, bool) {
+	lines := strings.Split(m.data, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, ".Sh ") {
+			continue
+		}
+		if strings.Join(roffArgs(line[4:]), " ") != name {
+			continue
+		}
+		// Comments are no part of the section's text
+		var body []string
+		for _, line := range lines[i+1:] {
+			if strings.HasPrefix(line, ".Sh ") {
+				break
+			}
+			if !isComment(line) {
+				body = append(body, line)
+			}
+		}
+		return body, true
+	}
+	return nil, false
+}
+
+// Report whether the .Bd display block started by 'line' preserves its
+// layout, as -literal and -unfilled displays do, rather than being filled.
+func isMdocLiteral(line string) bool {
+	for _, arg := range roffArgs(macroArgs(line)) {
+		if arg == "-literal" || arg == "-unfilled" {
+			return true
+		}
+	}
+	return false
+}
+
+// Split the lines of an mdoc section into its text blocks.  Literal .Bd
+// displays are kept line by line as preformatted blocks, while filled ones
+// are paragraphs of their own.  'name' is substituted for argument-less .Nm
+// macros.
+func mdocBlocks(lines []string, name string) []block {
+	var blocks []block
+	var text []string
+	pre := false
+	flush := func() {
+		body := strings.TrimRight(strings.Join(text, "\n"), "\n")
+		if !pre {
+			body = strings.Join(strings.Fields(body), " ")
+		}
+		if body != "" {
+			blocks = append(blocks, block{text: body, pre: pre})
+		}
+		text = nil
+	}
+	for _, line := range lines {
+		mc := ""
+		if strings.HasPrefix(line, ".") {
+			mc = macroName(line)
+		}
+		switch {
+		case mc == "Bd":
+			flush()
+			pre = isMdocLiteral(line)
+		case mc == "Ed":
+			flush()
+			pre = false
+		case pre && mc == "":
+			text = append(text, strings.TrimRight(stripEscapes(line), " \t"))
+		case pre:
+			text = append(text, mdocText(line, name))
+		case strings.TrimSpace(line) == "" || mc == "Pp":
+			flush()
+		default:
+			if t := mdocText(line, name); t != "" {
+				text = append(text, t)
+			}
+		}
+	}
+	flush()
+	return blocks
+}
+
+// Return the plain text of the mdoc section named 'sectname', and whether the
+// section exists.  Paragraphs and literal displays are separated by a blank
+// line.
+func (m *ManPage) getMdocSection(sectname string) (string, bool) {
+	lines, ok := m.mdocSection(sectname)
+	if !ok {
+		return "", false
+	}
+	return joinBlocks(mdocBlocks(lines, m.Name)), true
+}
+
+func (m *ManPage) parseMdocName() {
+	lines, _ := m.mdocSection("NAME")
+	for _, line := range lines {
+		if args := roffArgs(line); len(args) > 1 && args[0] == ".Nm" {
+			m.Name = strings.TrimRight(args[1], ` \,`)
+			return
+		}
+	}
+	sect, _ := m.getMdocSection("NAME")
+	name := strings.Split(sect, " ")[0]
+	m.Name = strings.TrimRight(name, ` \,`)
+}
+
+// Return the .Nd summary of the NAME section, or an empty string if there is
+// none.
+func (m *ManPage) mdocSummary() string {
+	lines, _ := m.mdocSection("NAME")
+	for _, line := range lines {
+		if strings.HasPrefix(line, ".Nd ") {
+			return strings.TrimSpace(mdocText(line, m.Name))
+		}
+	}
+	return ""
+}
+
+func (m *ManPage) parseMdocDesc() {
+	var ok bool
+	if m.Desc, ok = m.aliasedSection("DESCRIPTION"); !ok {
+		m.Desc = m.Summary
+	}
+}
+
+// Parse out the .It tagged list entries whose tags are flags
+func (m *ManPage) parseMdocOpts() {
+	lines, ok := m.mdocSection("OPTIONS")
+	if !ok {
+		if lines, ok = m.mdocSection("DESCRIPTION"); !ok {
+			return
+		}
+	}
+
+	var opt *Opt
+	depth := 0
+	for _, line := range lines {
+		args := roffArgs(line)
+		mc := ""
+		if len(args) > 0 && strings.HasPrefix(args[0], ".") {
+			mc = args[0][1:]
+		}
+
+		top := depth <= 1
+		switch mc {
+		case "Bl":
+			depth++
+		case "El":
+			depth--
+		}
+		if top && (mc == "It" || mc == "El") {
+			if opt != nil {
+				opt.Desc = strings.TrimSpace(opt.Desc)
+				m.Opts = append(m.Opts, *opt)
+				opt = nil
+			}
+			tag := mdocText(line, m.Name)
+			if mc == "It" && isFlag(tag) {
+				flags, arg, desc := splitFlags(tag)
+				arg, optional := splitArg(arg)
+				opt = &Opt{Name: flags[0], Arg: arg, OptionalArg: optional,
+					Desc: desc, Synonyms: flags[1:], Raw: line}
+			}
+			continue
+		}
+		if opt != nil {
+			opt.Raw += "\n" + line
+			if t := mdocText(line, m.Name); t != "" {
+				opt.Desc += " " + strings.Join(strings.Fields(t), " ")
+			}
+		}
+	}
+	if opt != nil {
+		opt.Desc = strings.TrimSpace(opt.Desc)
+		m.Opts = append(m.Opts, *opt)
+	}
+}
+
+// The layouts of .Dd dates, as written and as CVS $Mdocdate$ keywords expand
+var mdoc_date_layouts = []string{"January 2, 2006", "January 2 2006"}
+
+// Normalize an mdoc date such as "March 4, 2020" to 2020-03-04, leaving
+// dates in other forms as written
+func mdocDate(date string) string {
+	date = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(date, "$Mdocdate:"), "$"))
+	for _, layout := range mdoc_date_layouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return date
+}
+
+// Parse the .Dd, .Dt and .Os macros of the document prologue into the
+// fields set by .TH for man pages
+func (m *ManPage) parseMdocHeader() {
+	for _, line := range strings.Split(m.data, "\n") {
+		if !strings.HasPrefix(line, ".") {
+			continue
+		}
+		args := roffArgs(macroArgs(line))
+		switch macroName(line) {
+		case "Dd":
+			m.Date = mdocDate(strings.Join(args, " "))
+		case "Dt":
+			fields := []*string{&m.Title, &m.SectionNumber}
+			for i, arg := range args {
+				if i < len(fields) {
+					*fields[i] = stripEscapes(arg)
+				}
+			}
+		case "Os":
+			m.Source = stripEscapes(strings.Join(args, " "))
+		case "Sh":
+			return
+		}
+	}
+}
+
+// Collect the sections named by .Sx references, once each in the order they
+// are first referenced
+func (m *ManPage) parseMdocRefs() {
+	for _, line := range strings.Split(m.data, "\n") {
+		if !strings.HasPrefix(line, ".") {
+			continue
+		}
+		args := roffArgs(line[1:])
+		for i := 0; i < len(args); i++ {
+			if args[i] != "Sx" {
+				continue
+			}
+			var words []string
+			for i++; i < len(args) && !mdoc_callable_macros[args[i]]; i++ {
+				if len(args[i]) == 1 && strings.Contains(".,:;)]?!", args[i]) {
+					break
+				}
+				words = append(words, args[i])
+			}
+			i--
+			if ref := stripEscapes(strings.Join(words, " ")); ref != "" &&
+				!contains(m.InternalRefs, ref) {
+				m.InternalRefs = append(m.InternalRefs, ref)
+			}
+		}
+	}
+}
+
+// Parse all of the interesting parts of an mdoc page
+func (m *ManPage) parseMdoc() {
+	m.parseMdocHeader()
+	m.parseMdocName()
+	m.Summary = m.mdocSummary()
+	if m.wants(FieldDesc) {
+		m.parseMdocDesc()
+	}
+	if m.wants(FieldSynopsis) {
+		m.Synopsis, _ = m.getMdocSection("SYNOPSIS")
+	}
+	if m.wants(FieldExamples) {
+		m.parseExamples()
+	}
+	if m.wants(FieldBugs) {
+		m.Bugs, _ = m.aliasedSection("BUGS")
+	}
+	if m.wants(FieldNotes) {
+		m.parseNotes()
+	}
+	if m.wants(FieldLibrary) {
+		m.parseMdocPrototypes()
+		m.parseReturnValue()
+	}
+	if m.wants(FieldStandards) {
+		m.parseStandards()
+	}
+	if m.wants(FieldKeywords) {
+		m.parseKeywords()
+	}
+	if m.wants(FieldCopyright) {
+		m.parseCopyright()
+	}
+	m.parseVersion()
+	m.parseMdocRefs()
+	if m.wants(FieldOptions) {
+		m.parseMdocOpts()
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// opts - Post-processing of the options parsed from a man page.
+package goman
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var deprecated_re = regexp.MustCompile(`(?i)\b(deprecated|obsolete|obsoleted)\b`)
+
+// Words before deprecated_re that deny rather than mark a deprecation
+var not_deprecated_re = regexp.MustCompile(`(?i)\b(not|never|no longer)\s+$`)
+
+// The replacement a description names
+var replacement_re = regexp.MustCompile(
+	`(?i)\b(?:use\s+(\S+)\s+instead|(?:replaced|superseded)\s+by\s+(\S+))`)
+
+// A replacement given as an aside, e.g. "(use --bar instead)"
+var aside_replacement_re = regexp.MustCompile(`(?i)\(\s*use\s+\S+\s+instead[.!]?\s*\)`)
+
+// A single letter or digit, which BSD style options are named by
+var bare_flag_re = regexp.MustCompile(`^[A-Za-z0-9]$`)
+
+// The start of a flag's name following a '+', e.g. "+N", "+[num]" or
+// "+/pattern"
+var plus_flag_re = regexp.MustCompile(`^\+[A-Za-z0-9/{[]`)
+
+// Report whether 'tag' starts with a flag: a '-' or, as some classic tools
+// such as tar(1) take, a '+' followed by the flag's name
+func isFlag(tag string) bool {
+	return strings.HasPrefix(tag, "-") || plus_flag_re.MatchString(tag)
+}
+
+// Split the comma separated flags leading 'tag' from the text that follows
+// them, e.g. "-v, --verbose be chatty" yields [-v --verbose] and "be chatty".
+// An argument attached to a flag, as in "--color[=WHEN]" or "--file=NAME",
+// is returned separately.
+func splitFlags(tag string) ([]string, string, string) {
+	var flags []string
+	arg := ""
+	rest := tag
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		if !isFlag(rest) {
+			break
+		}
+		// A flag ends at a blank, at the comma before a synonym, or at
+		// an argument attached with '=' or '['
+		end := strings.IndexAny(rest, " \t\r\n,=[")
+		if end == -1 {
+			end = len(rest)
+		}
+		flag := rest[:end]
+		rest = rest[end:]
+		if strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, "[") {
+			end = strings.IndexAny(rest, " \t\r\n")
+			if end == -1 {
+				end = len(rest)
+			}
+			if arg == "" {
+				arg = strings.TrimRight(rest[:end], ",")
+			}
+			if strings.HasSuffix(rest[:end], ",") {
+				end--
+			}
+			rest = rest[end:]
+		}
+		more := strings.HasPrefix(rest, ",")
+		rest = strings.TrimPrefix(rest, ",")
+		if flag != "" {
+			flags = append(flags, flag)
+		}
+		if !more {
+			break
+		}
+	}
+	return flags, arg, rest
+}
+
+// Split an argument attached to a flag, as returned by splitFlags, into its
+// name and whether it is optional, e.g. "[=WHEN]" yields "WHEN" and true
+func splitArg(arg string) (string, bool) {
+	optional := strings.HasPrefix(arg, "[") && strings.HasSuffix(arg, "]")
+	if optional {
+		arg = arg[1 : len(arg)-1]
+	}
+	return strings.TrimPrefix(arg, "="), optional
+}
+
+// Arguments that follow their flag after a blank, written as a <placeholder>
+// or an uppercase word
+var placeholder_re = regexp.MustCompile(`^[ \t]*(<[^<>]+>|[A-Z][A-Z0-9_]*)([ \t]|$)`)
+
+// Return the argument placeholder leading 'rest', the text of a tag following
+// its flags, or an empty string if there is none
+func placeholder(rest string) string {
+	if match := placeholder_re.FindStringSubmatch(rest); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// Return the argument of the option as written after its flag, e.g.
+// "[=WHEN]".  Single letter flags take a required argument after a blank
+// rather than an '=', as do <placeholders>.
+func (o Opt) argForm() string {
+	if o.Arg == "" {
+		return ""
+	}
+	switch {
+	case o.OptionalArg && len(o.Name) == 2:
+		return "[" + o.Arg + "]"
+	case o.OptionalArg:
+		return "[=" + o.Arg + "]"
+	case len(o.Name) == 2 || strings.HasPrefix(o.Arg, "<"):
+		return " " + o.Arg
+	}
+	return "=" + o.Arg
+}
+
+// Options returns the options of the man page keyed by flag.  Each synonym of
+// an option is also a key for that option.
+func (m *ManPage) Options() map[string]Opt {
+	opts := make(map[string]Opt)
+	for _, opt := range m.Opts {
+		opts[opt.Name] = opt
+		for _, syn := range opt.Synonyms {
+			opts[syn] = opt
+		}
+	}
+	return opts
+}
+
+// ByName orders options alphabetically by flag, ignoring leading dashes so
+// that short and long options interleave.
+type ByName []Opt
+
+func (o ByName) Len() int      { return len(o) }
+func (o ByName) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o ByName) Less(i, j int) bool {
+	a, b := strings.TrimLeft(o[i].Name, "-"), strings.TrimLeft(o[j].Name, "-")
+	if a != b {
+		return a < b
+	}
+	return o[i].Name < o[j].Name
+}
+
+// Sort the options of the man page alphabetically by flag.  Options are kept
+// in the order they appear in the page unless this is called.
+func (m *ManPage) SortOptions() {
+	sort.Stable(ByName(m.Opts))
+}
+
+// Merge options that are documented more than once, keeping the position of
+// the first occurrence.  An option is the same as an earlier one when any of
+// its flags, whether its name or a synonym, names the earlier one.
+func (m *ManPage) dedupOpts() {
+	seen := make(map[string]int)
+	var opts []Opt
+	for _, opt := range m.Opts {
+		flags := append([]string{opt.Name}, opt.Synonyms...)
+		idx, ok := -1, false
+		for _, flag := range flags {
+			if idx, ok = seen[flag]; ok {
+				break
+			}
+		}
+		if !ok {
+			for _, flag := range flags {
+				seen[flag] = len(opts)
+			}
+			opts = append(opts, opt)
+			continue
+		}
+
+		prev := &opts[idx]
+		prev.Raw += "\n" + opt.Raw
+		for _, flag := range flags {
+			if flag != prev.Name && !contains(prev.Synonyms, flag) {
+				prev.Synonyms = append(prev.Synonyms, flag)
+			}
+			if _, ok := seen[flag]; !ok {
+				seen[flag] = idx
+			}
+		}
+		switch {
+		case strings.Contains(prev.Desc, opt.Desc):
+		case strings.Contains(opt.Desc, prev.Desc):
+			prev.Desc = opt.Desc
+		default:
+			prev.Desc += "\n\n" + opt.Desc
+		}
+	}
+	m.Opts = opts
+}
+
+// Report whether 'strs' contains 'str'
+func contains(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether 'desc' says that what it describes is deprecated or
+// obsolete, and does not rather say that it is not
+func isDeprecated(desc string) bool {
+	for _, loc := range deprecated_re.FindAllStringIndex(desc, -1) {
+		if !not_deprecated_re.MatchString(desc[:loc[0]]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flag the options whose descriptions mark them as deprecated, noting their
+// replacement if one is given.  Without an explicit deprecated or obsolete,
+// "use X instead" only marks an option as an aside in parentheses, and
+// "replaced by X" only when X is another documented option, so that advice
+// such as "use -a instead of listing them" is no deprecation.
+func (m *ManPage) markDeprecated() {
+	flags := make(map[string]bool)
+	for _, opt := range m.Opts {
+		flags[opt.Name] = true
+		for _, syn := range opt.Synonyms {
+			flags[syn] = true
+		}
+	}
+	for i := range m.Opts {
+		opt := &m.Opts[i]
+		marked := isDeprecated(opt.Desc)
+		if match := replacement_re.FindStringSubmatch(opt.Desc); match != nil {
+			repl := strings.Trim(match[1]+match[2], `.,;:'"()`)
+			switch {
+			case marked:
+			case match[1] != "":
+				marked = aside_replacement_re.MatchString(opt.Desc)
+			default:
+				marked = repl != opt.Name && flags[repl]
+			}
+			if marked {
+				opt.Replacement = repl
+			}
+		}
+		opt.Deprecated = marked
+	}
+}
+
+// A flag as it leads a word of a synopsis, e.g. "--color" of "--color=WHEN"
+var synopsis_flag_re = regexp.MustCompile(`^--?[A-Za-z0-9][A-Za-z0-9_-]*`)
+
+// WithMergeSynopsisOptions cross-references the flags of the SYNOPSIS with
+// the options the page documents.  Flags only the synopsis mentions are added
+// as options without a description, and 'InSynopsis' tells which options the
+// synopsis mentions.
+func WithMergeSynopsisOptions() ParseOption {
+	return func(m *ManPage) {
+		m.mergeSynopsis = true
+	}
+}
+
+// Return the flags the SYNOPSIS mentions, in the order they first appear
+func (m *ManPage) synopsisFlags() []string {
+	var flags []string
+	var walk func(n SynopsisNode)
+	walk = func(n SynopsisNode) {
+		if flag := synopsis_flag_re.FindString(n.Text); flag != "" && !contains(flags, flag) {
+			flags = append(flags, flag)
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	for _, tree := range m.SynopsisTree() {
+		walk(tree)
+	}
+	return flags
+}
+
+// Add the flags only the SYNOPSIS mentions to the options, and mark which
+// options it mentions
+func (m *ManPage) mergeSynopsisOpts() {
+	known := m.Options()
+	mentioned := make(map[string]bool)
+	for _, flag := range m.synopsisFlags() {
+		names := []string{flag}
+		if _, ok := known[flag]; !ok && !strings.HasPrefix(flag, "--") && len(flag) > 2 {
+			// Short flags are often bundled, as in -qv, which names each
+			// of them if they are all documented
+			var bundle []string
+			for _, c := range flag[1:] {
+				if _, ok := known["-"+string(c)]; !ok {
+					bundle = nil
+					break
+				}
+				bundle = append(bundle, "-"+string(c))
+			}
+			if len(bundle) > 0 {
+				names = bundle
+			}
+		}
+		for _, name := range names {
+			mentioned[name] = true
+			if _, ok := known[name]; !ok {
+				opt := Opt{Name: name, InSynopsis: true}
+				m.Opts = append(m.Opts, opt)
+				known[name] = opt
+			}
+		}
+	}
+
+	for i := range m.Opts {
+		opt := &m.Opts[i]
+		opt.InSynopsis = mentioned[opt.Name]
+		for _, syn := range opt.Synonyms {
+			opt.InSynopsis = opt.InSynopsis || mentioned[syn]
+		}
+	}
+}
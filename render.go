@@ -0,0 +1,342 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// render - Rendering of parsed man pages into other document formats.
+package goman
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Format identifies a document format a man page can be rendered into.
+type Format int
+
+const (
+	Text Format = iota
+	HTML
+	Markdown
+	ANSI
+)
+
+var format_names = map[Format]string{
+	Text:     "text",
+	HTML:     "html",
+	Markdown: "markdown",
+	ANSI:     "ansi",
+}
+
+func (f Format) String() string {
+	if name, ok := format_names[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// RenderOptions are the settings shared by all of the output formats.
+// 'Width' is the column text is wrapped at, with zero leaving lines as they
+// are for Text and wrapping ANSI output at 80 columns.  'Color' emboldens
+// headings and flags of ANSI output with terminal escape sequences.
+// 'MaxBlankLines' is the longest run of blank lines kept in Text, Markdown
+// and ANSI output outside of preformatted examples, which keep their layout.
+// Zero removes every blank line, while a negative count, as the To* methods
+// render with, keeps a single one.
+type RenderOptions struct {
+	Width         int
+	Color         bool
+	MaxBlankLines int
+}
+
+// The options the To* methods render with
+var default_render_opts = RenderOptions{MaxBlankLines: -1}
+
+// WithMaxBlankLines returns the options with runs of blank lines collapsed
+// to at most 'n' lines, e.g. RenderOptions{Width: 72}.WithMaxBlankLines(0).
+func (o RenderOptions) WithMaxBlankLines(n int) RenderOptions {
+	o.MaxBlankLines = n
+	return o
+}
+
+// Render returns the man page in the document format 'format'.
+func (m *ManPage) Render(format Format, opts RenderOptions) (string, error) {
+	limit := opts.MaxBlankLines
+	if limit < 0 {
+		limit = 1
+	}
+	switch format {
+	case Text:
+		return wrapLines(m.collapsed(limit).String(), opts.Width, ""), nil
+	case HTML:
+		return m.renderHTML(), nil
+	case Markdown:
+		return collapseBlankLines(m.renderMarkdown(), limit), nil
+	case ANSI:
+		return m.collapsed(limit).renderANSI(opts), nil
+	}
+	return "", fmt.Errorf("unsupported render format %v", format)
+}
+
+// Collapse the runs of blank lines in 'text' to at most 'limit' lines.  The
+// fenced code blocks of Markdown keep their layout.
+func collapseBlankLines(text string, limit int) string {
+	var lines []string
+	blanks, fenced := 0, false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "```") {
+			fenced = !fenced
+		}
+		if fenced || strings.TrimSpace(line) != "" {
+			blanks = 0
+		} else if blanks++; blanks > limit {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Return the blocks of the EXAMPLES section, telling the preformatted
+// examples from the text around them, and whether they make up the page's
+// Examples as parsed
+func (m *ManPage) exampleBlocks() ([]block, bool) {
+	var blocks []block
+	switch m.Format {
+	case "man":
+		blocks, _ = m.aliasedBlocks("EXAMPLES")
+	case "mdoc":
+		for _, alias := range SectionAliases["EXAMPLES"] {
+			if lines, ok := m.mdocSection(alias); ok {
+				blocks = mdocBlocks(lines, m.Name)
+				break
+			}
+		}
+	}
+	return blocks, len(blocks) > 0 && joinBlocks(blocks) == m.Examples
+}
+
+// Return a copy of the page for rendering, with the runs of blank lines in
+// its text collapsed to at most 'limit' lines.  Preformatted examples keep
+// their blank lines.
+func (m *ManPage) collapsed(limit int) *ManPage {
+	c := *m
+	c.Synopsis = collapseBlankLines(m.Synopsis, limit)
+	c.Desc = collapseBlankLines(m.Desc, limit)
+	c.Opts = make([]Opt, len(m.Opts))
+	for i, o := range m.Opts {
+		o.Desc = collapseBlankLines(o.Desc, limit)
+		c.Opts[i] = o
+	}
+
+	blocks, ok := m.exampleBlocks()
+	if !ok {
+		c.Examples = collapseBlankLines(m.Examples, limit)
+		return &c
+	}
+	sep := "\n"
+	if limit > 0 {
+		sep = "\n\n"
+	}
+	var text []string
+	for _, b := range blocks {
+		if !b.pre {
+			b.text = collapseBlankLines(b.text, limit)
+		}
+		text = append(text, b.text)
+	}
+	c.Examples = strings.Join(text, sep)
+	return &c
+}
+
+// Wrap each line of 'text' that is longer than 'width' columns at its
+// blanks, starting each line with 'indent'.  A zero width only indents.
+func wrapLines(text string, width int, indent string) string {
+	var b strings.Builder
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		words := strings.Fields(line)
+		if width <= 0 || len(indent)+len(line) <= width || len(words) == 0 {
+			if line != "" {
+				b.WriteString(indent + line)
+			}
+			continue
+		}
+		col := 0
+		for _, word := range words {
+			switch {
+			case col == 0:
+				b.WriteString(indent + word)
+				col = len(indent) + len(word)
+			case col+1+len(word) > width:
+				b.WriteString("\n" + indent + word)
+				col = len(indent) + len(word)
+			default:
+				b.WriteString(" " + word)
+				col += 1 + len(word)
+			}
+		}
+	}
+	return b.String()
+}
+
+// The sections given headings, and so anchors, in the HTML rendering
+var html_sections = []string{"SYNOPSIS", "DESCRIPTION", "OPTIONS"}
+
+// Return the id of the HTML anchor for section 'name'
+func htmlAnchor(name string) string {
+	return "sect-" + strings.ToLower(strings.Join(strings.Fields(name), "-"))
+}
+
+// Write 'text' as HTML paragraphs, one per blank line separated block.  The
+// page's .Sx references to sections with a heading become links.
+func (m *ManPage) writeHTMLParas(b *strings.Builder, text string) {
+	var refs []*regexp.Regexp
+	for _, ref := range m.InternalRefs {
+		if contains(html_sections, ref) {
+			refs = append(refs, regexp.MustCompile(`\b`+regexp.QuoteMeta(ref)+`\b`))
+		}
+	}
+	for _, para := range strings.Split(text, "\n\n") {
+		para = html.EscapeString(para)
+		for _, re := range refs {
+			para = re.ReplaceAllStringFunc(para, func(ref string) string {
+				return "<a href=\"#" + htmlAnchor(ref) + "\">" + ref + "</a>"
+			})
+		}
+		b.WriteString("<p>" + para + "</p>\n")
+	}
+}
+
+// Write the HTML heading of section 'name'
+func writeHTMLHeading(b *strings.Builder, name string) {
+	b.WriteString("<h2 id=\"" + htmlAnchor(name) + "\">" + name + "</h2>\n")
+}
+
+// ToHTML returns the man page as a standalone HTML document.
+func (m *ManPage) ToHTML() string {
+	str, _ := m.Render(HTML, default_render_opts)
+	return str
+}
+
+func (m *ManPage) renderHTML() string {
+	var b strings.Builder
+	name := html.EscapeString(m.Name)
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n" +
+		"<meta charset=\"utf-8\">\n<title>" + name + "</title>\n" +
+		"</head>\n<body>\n<h1>" + name + "</h1>\n")
+
+	if m.Synopsis != "" {
+		writeHTMLHeading(&b, "SYNOPSIS")
+		m.writeHTMLParas(&b, m.Synopsis)
+	}
+	if m.Desc != "" {
+		writeHTMLHeading(&b, "DESCRIPTION")
+		m.writeHTMLParas(&b, m.Desc)
+	}
+	if len(m.Opts) > 0 {
+		writeHTMLHeading(&b, "OPTIONS")
+		b.WriteString("<dl>\n")
+		for _, o := range m.Opts {
+			b.WriteString("<dt>" + html.EscapeString(o.flags()) +
+				"</dt>\n<dd>\n")
+			m.writeHTMLParas(&b, o.Desc)
+			b.WriteString("</dd>\n")
+		}
+		b.WriteString("</dl>\n")
+	}
+
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// Write a man page section as Markdown, fencing its preformatted blocks.  The
+// blocks are taken from the roff source when available so that examples keep
+// their layout, otherwise 'text' is used.
+func (m *ManPage) writeMarkdownSection(b *strings.Builder, title, text string) {
+	blocks, ok := m.aliasedBlocks(title)
+	if !ok || m.Format != "man" {
+		if text == "" {
+			return
+		}
+		blocks = []block{{text: text}}
+	}
+
+	b.WriteString("\n## " + title + "\n")
+	for _, blk := range blocks {
+		if blk.pre {
+			b.WriteString("\n```\n" + blk.text + "\n```\n")
+		} else {
+			b.WriteString("\n" + blk.text + "\n")
+		}
+	}
+}
+
+// ToMarkdown returns the man page as a Markdown document.
+func (m *ManPage) ToMarkdown() string {
+	str, _ := m.Render(Markdown, default_render_opts)
+	return str
+}
+
+func (m *ManPage) renderMarkdown() string {
+	var b strings.Builder
+	b.WriteString("# " + m.Name + "\n")
+	m.writeMarkdownSection(&b, "SYNOPSIS", m.Synopsis)
+	m.writeMarkdownSection(&b, "DESCRIPTION", m.Desc)
+
+	if len(m.Opts) > 0 {
+		b.WriteString("\n## OPTIONS\n\n")
+		for _, o := range m.Opts {
+			b.WriteString("* `" + strings.ReplaceAll(o.flags(), ", ", "`, `") + "`: " +
+				strings.ReplaceAll(o.Desc, "\n\n", "\n\n  ") + "\n")
+		}
+	}
+
+	m.writeMarkdownSection(&b, "EXAMPLES", m.Examples)
+	return b.String()
+}
+
+// The terminal escape sequences that embolden text and reset it
+const ansi_bold, ansi_reset = "\x1b[1m", "\x1b[0m"
+
+// Render the man page laid out for a terminal as man(1) does, with headings
+// at the margin and their text indented below them.
+func (m *ManPage) renderANSI(opts RenderOptions) string {
+	width := opts.Width
+	if width <= 0 {
+		width = 80
+	}
+	bold := func(str string) string {
+		if opts.Color {
+			return ansi_bold + str + ansi_reset
+		}
+		return str
+	}
+
+	var b strings.Builder
+	// Sections are separated by a single blank line, whatever their text ends with
+	section := func(title, text string) {
+		if text = strings.Trim(text, "\n"); text != "" {
+			b.WriteString(bold(title) + "\n" + wrapLines(text, width, "       ") + "\n\n")
+		}
+	}
+	name := m.Name
+	if m.Summary != "" {
+		name += " - " + m.Summary
+	}
+	section("NAME", name)
+	section("SYNOPSIS", m.Synopsis)
+	section("DESCRIPTION", m.Desc)
+	if len(m.Opts) > 0 {
+		b.WriteString(bold("OPTIONS") + "\n")
+		for _, o := range m.Opts {
+			b.WriteString("       " + bold(o.flags()) + "\n" +
+				wrapLines(strings.Trim(o.Desc, "\n"), width, "              ") + "\n\n")
+		}
+	}
+	section("EXAMPLES", m.Examples)
+	return strings.TrimSuffix(b.String(), "\n")
+}
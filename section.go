@@ -0,0 +1,131 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// section - Listing, walking and ordering the sections of a man page.
+package goman
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A section of a man page: its heading and plain text
+type Section struct {
+	Name string
+	Body string
+}
+
+// The macros that head sections and subsections in each dialect
+var heading_macros = map[string]map[string]bool{
+	"man":  {"SH": true, "SS": true},
+	"mdoc": {"Sh": true, "Ss": true},
+}
+
+// Return the heading of the section or subsection started by 'line', and
+// whether the line starts one at all.
+func (m *ManPage) sectionHeading(line string) (string, bool) {
+	if m.Format == "cat" {
+		line = strings.TrimRight(line, " \t")
+		return line, cat_heading_re.MatchString(line)
+	}
+	if !strings.HasPrefix(line, ".") || !heading_macros[m.Format][macroName(line)] {
+		return "", false
+	}
+	return stripEscapes(strings.Join(roffArgs(macroArgs(line)), " ")), true
+}
+
+// SectionNames returns the headings of the page's sections, and of the
+// subsections within them, in the order they appear.  Both man(7) and mdoc(7)
+// headings are recognized.  Only the headings are scanned, no section text is
+// extracted.
+func (m *ManPage) SectionNames() []string {
+	var names []string
+	for _, line := range strings.Split(m.data, "\n") {
+		if name, ok := m.sectionHeading(line); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// HasSection reports whether the page has a section headed 'name', without
+// extracting its text.
+func (m *ManPage) HasSection(name string) bool {
+	if m.Format == "man" {
+		_, _, err := m.findSection(regexp.QuoteMeta(name))
+		return err == nil
+	}
+	for _, heading := range m.SectionNames() {
+		if heading == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether 'line' heads a section, rather than a subsection, and if so
+// return its heading
+func (m *ManPage) topHeading(line string) (string, bool) {
+	name, ok := m.sectionHeading(line)
+	if !ok || m.Format == "cat" {
+		return name, ok
+	}
+	mc := macroName(line)
+	return name, mc == "SH" || mc == "Sh"
+}
+
+// Return the plain text of the section body 'lines', as the fields of the
+// page's format are extracted
+func (m *ManPage) bodyLines(lines []string) string {
+	switch m.Format {
+	case "mdoc":
+		var body []string
+		for _, line := range lines {
+			if !isComment(line) {
+				body = append(body, line)
+			}
+		}
+		return joinBlocks(mdocBlocks(body, m.Name))
+	case "cat":
+		return catText(lines)
+	}
+	return joinBlocks(roffBlocks(strings.Join(lines, "\n"), m.keepFormatting))
+}
+
+// WalkSections calls 'fn' with the heading and plain text of each section of
+// the page in the order they appear, subsections being part of the text of
+// their section.  Each section is extracted only as it is visited, and the
+// walk stops at the first error 'fn' returns, which is returned.
+func (m *ManPage) WalkSections(fn func(name, body string) error) error {
+	name, started := "", false
+	var lines []string
+	for _, line := range strings.Split(m.data, "\n") {
+		if heading, ok := m.topHeading(line); ok {
+			if started {
+				if err := fn(name, m.bodyLines(lines)); err != nil {
+					return err
+				}
+			}
+			name, started, lines = heading, true, nil
+		} else if started {
+			lines = append(lines, line)
+		}
+	}
+	if started {
+		return fn(name, m.bodyLines(lines))
+	}
+	return nil
+}
+
+// OrderedSections returns the sections of the page in the order they appear
+// in the source, so that the page can be rendered or encoded as it is laid
+// out, as MarshalJSON does.
+func (m *ManPage) OrderedSections() []Section {
+	var sects []Section
+	m.WalkSections(func(name, body string) error {
+		sects = append(sects, Section{name, body})
+		return nil
+	})
+	return sects
+}
@@ -0,0 +1,129 @@
+package goman
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSectionNames(t *testing.T) {
+	man := parseString(".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH DESCRIPTION\n.SS Details\n" +
+		"x\n.SH \"SEE ALSO\"\nbaz(1)\n")
+	names := []string{"NAME", "DESCRIPTION", "Details", "SEE ALSO"}
+	if found := man.SectionNames(); !reflect.DeepEqual(found, names) {
+		t.Errorf("SectionNames: expected %q, found %q\n", names, found)
+	}
+	if !man.HasSection("SEE ALSO") || man.HasSection("OPTIONS") {
+		t.Errorf("HasSection: expected only SEE ALSO of SEE ALSO and OPTIONS\n")
+	}
+
+	man = parseString(strings.Replace(mdoc_page, ".Sh BUGS", ".Ss Caveats\nx\n.Sh BUGS", 1))
+	names = []string{"NAME", "SYNOPSIS", "DESCRIPTION", "Caveats", "BUGS"}
+	if found := man.SectionNames(); !reflect.DeepEqual(found, names) {
+		t.Errorf("SectionNames: expected %q, found %q\n", names, found)
+	}
+
+	man = parseString(cat_page)
+	names = []string{"NAME", "SYNOPSIS", "DESCRIPTION", "SEE ALSO"}
+	if found := man.SectionNames(); !reflect.DeepEqual(found, names) {
+		t.Errorf("SectionNames: expected %q, found %q\n", names, found)
+	}
+	if !man.HasSection("SYNOPSIS") {
+		t.Errorf("HasSection: expected SYNOPSIS in a cat page\n")
+	}
+}
+
+func TestWalkSections(t *testing.T) {
+	man := parseString(".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH DESCRIPTION\nDoes\nthings.\n" +
+		".SS Details\nx\n.SH \"SEE ALSO\"\nbaz(1)\n")
+	var names, bodies []string
+	err := man.WalkSections(func(name, body string) error {
+		names, bodies = append(names, name), append(bodies, body)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"NAME", "DESCRIPTION", "SEE ALSO"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("WalkSections: expected %q, found %q\n", expected, names)
+	}
+	if len(bodies) != 3 || bodies[0] != "foo - bar" || bodies[2] != "baz(1)" ||
+		!strings.HasPrefix(bodies[1], "Does things.") {
+		t.Errorf("WalkSections: expected the text of each section, found %q\n", bodies)
+	}
+
+	// The walk stops at the first error
+	stop := errors.New("stop")
+	names = nil
+	err = parseString(mdoc_page).WalkSections(func(name, body string) error {
+		names = append(names, name)
+		if name == "SYNOPSIS" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || !reflect.DeepEqual(names, []string{"NAME", "SYNOPSIS"}) {
+		t.Errorf("WalkSections: expected to stop at SYNOPSIS, found %q %v\n", names, err)
+	}
+
+	names = nil
+	parseString(cat_page).WalkSections(func(name, body string) error {
+		if name == "SYNOPSIS" && body != "foo [-q] file" {
+			t.Errorf("WalkSections: expected 'foo [-q] file', found '%s'\n", body)
+		}
+		names = append(names, name)
+		return nil
+	})
+	if expected := []string{"NAME", "SYNOPSIS", "DESCRIPTION", "SEE ALSO"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("WalkSections: expected %q, found %q\n", expected, names)
+	}
+}
+
+func TestOrderedSections(t *testing.T) {
+	man := parseString(".TH FOO 1\n.SH NAME\nfoo \\- bar\n.SH SYNOPSIS\nfoo\n" +
+		".SH OPTIONS\nnone\n.SH DESCRIPTION\nDoes things.\n")
+	expected := []Section{
+		{"NAME", "foo - bar"},
+		{"SYNOPSIS", "foo"},
+		{"OPTIONS", "none"},
+		{"DESCRIPTION", "Does things."},
+	}
+	if found := man.OrderedSections(); !reflect.DeepEqual(found, expected) {
+		t.Errorf("OrderedSections: expected %q, found %q\n", expected, found)
+	}
+
+	// Encoded pages keep the order too
+	data, err := json.Marshal(man)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Name     string
+		Sections []Section
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Name != "foo" || !reflect.DeepEqual(decoded.Sections, expected) {
+		t.Errorf("MarshalJSON: expected %q, found %s\n", expected, data)
+	}
+	var buf bytes.Buffer
+	var round ManPage
+	if err := gob.NewEncoder(&buf).Encode(man); err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewDecoder(&buf).Decode(&round); err != nil {
+		t.Fatal(err)
+	}
+	if found := round.OrderedSections(); !reflect.DeepEqual(found, expected) {
+		t.Errorf("GobDecode: expected %q, found %q\n", expected, found)
+	}
+
+	if found := parseString(".TH FOO 1\n").OrderedSections(); len(found) != 0 {
+		t.Errorf("OrderedSections: expected no sections, found %q\n", found)
+	}
+}
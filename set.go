@@ -0,0 +1,75 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// set - A cache of the parsed man pages of a man tree.
+package goman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ManPageSet caches the parsed man pages found under a man tree such as
+// /usr/share/man, so each page is only parsed once.  It is safe for
+// concurrent use.
+type ManPageSet struct {
+	Root  string
+	mu    sync.Mutex
+	pages map[string]*ManPage
+}
+
+// Instantiate a set for the man tree rooted at 'root'.
+func NewManPageSet(root string) *ManPageSet {
+	return &ManPageSet{Root: root, pages: make(map[string]*ManPage)}
+}
+
+// Locate the file holding the page 'name' within the section directory
+// 'sect' (e.g. "man1").  Names holding path separators or glob
+// metacharacters do not name a page.
+func (s *ManPageSet) find(sect, name string) (string, error) {
+	if strings.ContainsAny(sect+name, `/\*?[`) || sect == ".." || name == ".." {
+		return "", fmt.Errorf("invalid man page %s/%s: %w", sect, name, os.ErrNotExist)
+	}
+	matches, err := filepath.Glob(filepath.Join(s.Root, sect, name+".*"))
+	if err != nil {
+		return "", fmt.Errorf("error locating man page: %w", err)
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no man page %s/%s: %w", sect, name, os.ErrNotExist)
+	}
+	return matches[0], nil
+}
+
+// Lookup returns the parsed man page 'name' from the section directory 'sect'
+// (e.g. "man1"), parsing it on first use.  Errors for missing pages wrap
+// os.ErrNotExist.
+func (s *ManPageSet) Lookup(sect, name string) (*ManPage, error) {
+	path, err := s.find(sect, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.load(path)
+}
+
+// Return the parsed man page at 'path', parsing it on first use
+func (s *ManPageSet) load(path string) (*ManPage, error) {
+	s.mu.Lock()
+	man, ok := s.pages[path]
+	s.mu.Unlock()
+	if ok {
+		return man, nil
+	}
+
+	man, err := NewManPage(path)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.pages[path] = man
+	s.mu.Unlock()
+	return man, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// stats - Counters of the health of a corpus of parsed pages.
+package goman
+
+// ParseStats counts how parsing a corpus of pages went, for monitoring its
+// quality over time.  'Parsed' and 'Failed' count the pages that parsed and
+// those that did not, 'Warned' the parsed pages with authoring mistakes or
+// parsing warnings, and 'Warnings' each kind of mistake across all pages.
+type ParseStats struct {
+	Parsed   int
+	Failed   int
+	Warned   int
+	Warnings map[WarningKind]int
+}
+
+// Count the parsed page 'm' and the authoring mistakes recorded parsing it
+func (s *ParseStats) addPage(m *ManPage) {
+	if s.Warnings == nil {
+		s.Warnings = make(map[WarningKind]int)
+	}
+	s.Parsed++
+	for _, mistake := range m.mistakes {
+		s.Warnings[mistake.kind]++
+	}
+	if len(m.Warnings) > 0 || len(m.mistakes) > 0 {
+		s.Warned++
+	}
+}
+
+// Count the pages of a parse that yielded 'pages' and failed with 'errs'
+func (s *ParseStats) add(pages []*ManPage, errs []error) {
+	for _, m := range pages {
+		s.addPage(m)
+	}
+	s.Failed += len(errs)
+}
+
+// ParseDirStats parses every man page found under 'dir' as ParseDir does,
+// also returning the counts of the pages parsed, failed and warned about.
+func ParseDirStats(dir string, concurrency int) ([]*ManPage, []error, ParseStats) {
+	pages, errs := ParseDir(dir, concurrency)
+	var stats ParseStats
+	stats.add(pages, errs)
+	return pages, errs, stats
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// stream - Extraction of man page sections without parsing the whole page.
+package goman
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// The longest line SectionFromReader accepts
+const max_line_len = 1024 * 1024
+
+// SectionFromReader returns the text of the section 'name' of the man page
+// read from 'r', which may be compressed.  Reading stops at the end of the
+// section, so the rest of the page is neither read nor parsed.
+func SectionFromReader(r io.Reader, name string) (string, error) {
+	rdr, err := decompress(r)
+	if err != nil {
+		return "", err
+	}
+	defer rdr.Close()
+
+	scanner := bufio.NewScanner(rdr)
+	scanner.Buffer(nil, max_line_len)
+	var src strings.Builder
+	heading, nm, end := "", "", ""
+	for scanner.Scan() {
+		// Lines are read as parse() normalizes them, skipping .ig blocks
+		line := spaceMacroArgs(strings.TrimSuffix(scanner.Text(), "\r"))
+		mc := ""
+		if strings.HasPrefix(line, ".") {
+			mc = macroName(line)
+		}
+		if end != "" {
+			if strings.TrimRight(line, " \t") == "."+end {
+				end = ""
+			}
+			continue
+		} else if mc == "ig" {
+			end = blockEnd(line, 0)
+			continue
+		}
+		if args := roffArgs(line); mc == "Nm" && nm == "" && len(args) > 1 {
+			nm = args[1]
+		}
+		if mc == "SH" || mc == "Sh" {
+			if heading != "" {
+				break
+			}
+			if strings.Join(roffArgs(macroArgs(line)), " ") == name {
+				heading = mc
+			}
+		}
+		if heading != "" {
+			src.WriteString(line + "\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading man page: %w", err)
+	}
+	if heading == "" {
+		return "", &ParseError{errmsg: "Error locating section " + name}
+	}
+
+	man := ManPage{Name: nm, data: normalize(src.String())}
+	if heading == "Sh" {
+		text, _ := man.getMdocSection(name)
+		return text, nil
+	}
+	text, _ := man.getSection(regexp.QuoteMeta(name))
+	return text, nil
+}
@@ -0,0 +1,47 @@
+package goman
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSectionFromReader(t *testing.T) {
+	fil, err := os.Open("./test.1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fil.Close()
+
+	synopsis, err := SectionFromReader(fil, "SYNOPSIS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synopsis != "foobar [baz] -q -u -x" {
+		t.Errorf("SectionFromReader: expected 'foobar [baz] -q -u -x', found '%s'\n", synopsis)
+	}
+
+	desc, err := SectionFromReader(strings.NewReader(mdoc_page), "DESCRIPTION")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(desc, "The foobar utility does nothing.") {
+		t.Errorf("SectionFromReader: found '%s'\n", desc)
+	}
+
+	// Unspaced headings are found, while text lines and ignored blocks
+	// starting with a heading's name are not headings
+	src := ".TH FOO 1\n.ig\n.SH NAME\n..\n.SH\"NAME\"\nfoo \\- bar\nSH is not a heading\n" +
+		".SH DESCRIPTION\nthings\n"
+	name, err := SectionFromReader(strings.NewReader(src), "NAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "foo - bar SH is not a heading" {
+		t.Errorf("SectionFromReader: expected 'foo - bar SH is not a heading', found '%s'\n", name)
+	}
+
+	if _, err := SectionFromReader(strings.NewReader(mdoc_page), "MISSING"); err == nil {
+		t.Errorf("SectionFromReader: expected an error for a missing section\n")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// strict - Strict parsing, which rejects pages with authoring mistakes.
+package goman
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The macros of man(7), along with the historic ones and the tbl(1) and
+// eqn(1) delimiters that pages commonly use
+var man_macros = map[string]bool{
+	"AT": true, "B": true, "BI": true, "BR": true, "DT": true, "EE": true,
+	"EN": true, "EQ": true, "TE": true, "TS": true, "T&": true,
+	"EX": true, "HP": true, "I": true, "IB": true, "IP": true, "IR": true,
+	"IX": true, "LP": true, "ME": true, "MT": true, "OP": true, "P": true,
+	"PD": true, "PP": true, "RB": true, "RE": true, "RI": true, "RS": true,
+	"SB": true, "SH": true, "SM": true, "SS": true, "SY": true, "TH": true,
+	"TP": true, "TQ": true, "UC": true, "UE": true, "UR": true, "YS": true,
+}
+
+// Requests that define a macro, whose body runs to a ".." line
+var define_requests = map[string]bool{"de": true, "de1": true, "am": true}
+
+// WithStrict rejects pages with authoring mistakes rather than working around
+// them: macros that are neither man(7) macros nor defined by the page, .nf
+// blocks without a closing .fi or the reverse, and a missing NAME section.
+// The first mistake is returned as a *ParseError.
+func WithStrict() ParseOption {
+	return func(m *ManPage) {
+		m.strict = true
+	}
+}
+
+// The kinds of authoring mistake that strict parsing rejects and ParseStats
+// counts
+type WarningKind int
+
+const (
+	// The page has no NAME section
+	WarnMissingName WarningKind = iota
+	// A preformatted block such as .nf is not closed, or closes nothing
+	WarnUnbalancedBlock
+	// A macro is neither a man(7) macro nor defined by the page
+	WarnUnknownMacro
+)
+
+var warning_kind_names = map[WarningKind]string{
+	WarnMissingName:     "missing NAME",
+	WarnUnbalancedBlock: "unbalanced block",
+	WarnUnknownMacro:    "unknown macro",
+}
+
+func (k WarningKind) String() string {
+	if name, ok := warning_kind_names[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("WarningKind(%d)", int(k))
+}
+
+// An authoring mistake found while parsing a page
+type mistake struct {
+	kind WarningKind
+	err  *ParseError
+}
+
+// Record the authoring mistakes in the roff source 'data' the page was parsed
+// from, for strict parsing to reject and ParseStats to count.  The lines are
+// those of 'data' as given, before .ig blocks were removed.
+func (m *ManPage) recordMistakes(data string) {
+	m.mistakes = nil
+	m.findMistakes(data, func(kind WarningKind, err *ParseError) bool {
+		m.mistakes = append(m.mistakes, mistake{kind, err})
+		return true
+	})
+}
+
+// Return the first authoring mistake recorded while parsing the page, if any
+func (m *ManPage) checkStrict() error {
+	if len(m.mistakes) == 0 {
+		return nil
+	}
+	return m.mistakes[0].err
+}
+
+// Call 'fn' with each authoring mistake in the roff source 'data' of the
+// parsed page, in the order they are found, until it returns false.
+func (m *ManPage) findMistakes(data string, fn func(WarningKind, *ParseError) bool) {
+	if m.Format == "man" {
+		data = spaceMacroArgs(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data))
+		defined := map[string]bool{}
+		start, startLine, end := "", 0, ""
+		unclosed := func() bool {
+			err := &ParseError{errmsg: "." + start + " without a closing ." +
+				pre_macros[start], Line: startLine}
+			start = ""
+			return fn(WarnUnbalancedBlock, err)
+		}
+		for i, line := range strings.Split(data, "\n") {
+			if end != "" {
+				if strings.TrimRight(line, " \t") == "."+end {
+					end = ""
+				}
+				continue
+			}
+			if !strings.HasPrefix(line, ".") || isComment(line) {
+				continue
+			}
+			name := macroName(line)
+			args := roffArgs(macroArgs(line))
+			ok := true
+			switch {
+			case name == "ig":
+				end = blockEnd(line, 0)
+			case define_requests[name] && len(args) > 0:
+				defined[args[0]] = true
+				end = blockEnd(line, 1)
+			case name == "SH" && start != "":
+				ok = unclosed()
+			case start != "" && name == pre_macros[start]:
+				start = ""
+			case start == "" && pre_macros[name] != "":
+				start, startLine = name, i+1
+			case start == "" && isPreEnd(name):
+				ok = fn(WarnUnbalancedBlock, &ParseError{
+					errmsg: "." + name + " without an opening block", Line: i + 1})
+			case macro_re.MatchString(line) && !man_macros[name] && !defined[name]:
+				ok = fn(WarnUnknownMacro, &ParseError{errmsg: "unknown macro ." + name,
+					Line: i + 1})
+			}
+			if !ok {
+				return
+			}
+		}
+		if start != "" && !unclosed() {
+			return
+		}
+	}
+	if !m.HasSection("NAME") {
+		fn(WarnMissingName, &ParseError{errmsg: "missing NAME section"})
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// stub - Detection of placeholder pages that document nothing.
+package goman
+
+// Sections that only name or point away from a page, and are no
+// documentation of their own
+var stub_sections = map[string]bool{
+	"NAME":     true,
+	"SEE ALSO": true,
+}
+
+// IsStub reports whether the page is a placeholder rather than documentation:
+// a .so redirect to another page, or a page with no text beyond its NAME line
+// and SEE ALSO references, such as one lacking a DESCRIPTION.
+func (m *ManPage) IsStub() bool {
+	if m.Redirect != "" {
+		return true
+	}
+	for _, name := range m.SectionNames() {
+		if stub_sections[name] {
+			continue
+		}
+		if text, ok := m.sectionLines(name); ok && text != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// subcommand - Parsing of the subcommands a program documents.
+package goman
+
+import (
+	"strings"
+)
+
+// A subcommand, or verb, of the program that the man page describes, such as
+// "add" for git(1).
+type Subcommand struct {
+	Name string
+	Desc string
+}
+
+// Return the subcommand named by the heading or entry tag 'tag', which may be
+// followed by its usage, e.g. "add [options] file"
+func subcommandName(tag string) string {
+	fields := strings.Fields(tag)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "-") || isBullet(fields[0]) {
+		return ""
+	}
+	return strings.TrimRight(fields[0], ",:")
+}
+
+// Parse the subcommands from the COMMANDS or SUBCOMMANDS section.  Each
+// subcommand is either a subsection of its own or an entry of the section,
+// and nothing outside of the section is considered.
+func (m *ManPage) parseSubcommands() {
+	_, idx, err := m.findSection(`(SUB)?COMMANDS`)
+	if err != nil {
+		return
+	}
+	data, _ := m.sectionData(`(SUB)?COMMANDS`)
+
+	// Subsections, when there are any, hold one subcommand each
+	var cmd *Subcommand
+	var body []string
+	add := func() {
+		if cmd != nil && cmd.Name != "" {
+			cmd.Desc = joinBlocks(roffBlocks(strings.Join(body, "\n"), m.keepFormatting))
+			m.Subcommands = append(m.Subcommands, *cmd)
+		}
+		cmd, body = nil, nil
+	}
+	for _, line := range strings.Split(data, "\n") {
+		if strings.HasPrefix(line, ".") && macroName(line) == "SS" {
+			add()
+			heading := stripEscapes(strings.Join(roffArgs(macroArgs(line)), " "))
+			cmd = &Subcommand{Name: subcommandName(heading)}
+		} else if cmd != nil {
+			body = append(body, line)
+		}
+	}
+	add()
+	if len(m.Subcommands) > 0 {
+		return
+	}
+
+	m.walkEntries(idx, true, func(mt macro_type, e entry) {
+		if name := subcommandName(e.tag); mt != b_macro && name != "" {
+			m.Subcommands = append(m.Subcommands, Subcommand{
+				Name: name,
+				Desc: m.bodyText(e.body),
+			})
+		}
+	})
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// synopsis - The structure of the usage forms of a SYNOPSIS.
+package goman
+
+import (
+	"strings"
+)
+
+// SynopsisKind says what a node of a synopsis tree stands for
+type SynopsisKind int
+
+const (
+	// A word of the usage, such as the command, a flag or a placeholder
+	SynopsisWord SynopsisKind = iota
+	// Parts that go together, such as a whole form or an alternative
+	SynopsisSequence
+	// Parts that may be left out, written [...]
+	SynopsisOptional
+	// Parts that must be given, grouping alternatives as {...}
+	SynopsisRequired
+	// Alternatives of which one is given, written a | b
+	SynopsisChoice
+)
+
+// SynopsisNode is a node of the tree of a usage form.  'Text' is set for
+// words, while the other kinds hold their parts, or for choices the
+// alternatives, in 'Children'.  'Repeat' is set for parts followed by "...",
+// which may be given more than once.
+type SynopsisNode struct {
+	Kind     SynopsisKind
+	Text     string
+	Repeat   bool
+	Children []SynopsisNode
+}
+
+// Returns the node as written in a synopsis, e.g. "[-a | -b] file..."
+func (n SynopsisNode) String() string {
+	var parts []string
+	for _, child := range n.Children {
+		parts = append(parts, child.String())
+	}
+	var str string
+	switch n.Kind {
+	case SynopsisWord:
+		str = n.Text
+	case SynopsisOptional:
+		str = "[" + strings.Join(parts, " ") + "]"
+	case SynopsisRequired:
+		str = "{" + strings.Join(parts, " ") + "}"
+	case SynopsisChoice:
+		str = strings.Join(parts, " | ")
+	default:
+		str = strings.Join(parts, " ")
+	}
+	if n.Repeat {
+		str += "..."
+	}
+	return str
+}
+
+// Split a usage form into words and the brackets, braces, bars and
+// ellipses that structure it
+func synopsisTokens(form string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for i := 0; i < len(form); i++ {
+		switch c := form[i]; {
+		case c == ' ' || c == '\t':
+			flush()
+		case strings.IndexByte("[]{}|", c) != -1:
+			flush()
+			tokens = append(tokens, string(c))
+		case strings.HasPrefix(form[i:], "..."):
+			flush()
+			tokens = append(tokens, "...")
+			i += 2
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Parse the parts of a group from 'tokens' up to the closing 'end', which is
+// empty for a whole form, returning them and the tokens that follow.  Parts
+// separated by bars are gathered into a choice.
+func parseSynopsisGroup(tokens []string, end string) ([]SynopsisNode, []string) {
+	var alts [][]SynopsisNode
+	var parts []SynopsisNode
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		tokens = tokens[1:]
+		switch tok {
+		case "[", "{":
+			close, kind := "]", SynopsisOptional
+			if tok == "{" {
+				close, kind = "}", SynopsisRequired
+			}
+			var children []SynopsisNode
+			children, tokens = parseSynopsisGroup(tokens, close)
+			parts = append(parts, SynopsisNode{Kind: kind, Children: children})
+		case "]", "}":
+			if tok == end {
+				return synopsisChoice(append(alts, parts)), tokens
+			}
+			// A stray closer closes nothing
+		case "|":
+			alts, parts = append(alts, parts), nil
+		case "...":
+			if len(parts) > 0 {
+				parts[len(parts)-1].Repeat = true
+			} else {
+				parts = append(parts, SynopsisNode{Kind: SynopsisWord, Text: tok})
+			}
+		default:
+			parts = append(parts, SynopsisNode{Kind: SynopsisWord, Text: tok})
+		}
+	}
+	return synopsisChoice(append(alts, parts)), tokens
+}
+
+// Return the parts of a group given its alternatives, which are a choice of
+// their own when there is more than one
+func synopsisChoice(alts [][]SynopsisNode) []SynopsisNode {
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	choice := SynopsisNode{Kind: SynopsisChoice}
+	for _, alt := range alts {
+		if len(alt) == 1 {
+			choice.Children = append(choice.Children, alt[0])
+		} else {
+			choice.Children = append(choice.Children,
+				SynopsisNode{Kind: SynopsisSequence, Children: alt})
+		}
+	}
+	return []SynopsisNode{choice}
+}
+
+// SynopsisTree returns the structure of each form of the SYNOPSIS, as given
+// by SynopsisLines, as a sequence node.  Optional parts, alternatives and
+// repetition are nested as written, so that "[-a | -b] file..." is an
+// optional choice of -a or -b followed by a repeatable file.
+func (m *ManPage) SynopsisTree() []SynopsisNode {
+	var trees []SynopsisNode
+	for _, form := range m.SynopsisLines() {
+		children, _ := parseSynopsisGroup(synopsisTokens(form), "")
+		trees = append(trees, SynopsisNode{Kind: SynopsisSequence, Children: children})
+	}
+	return trees
+}
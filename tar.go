@@ -0,0 +1,62 @@
+// Copyright (c) 2016, Matt Davis following the permissive ISC license.
+// See the LICENSE file that accompanies this software.
+// https://www.isc.org/downloads/software-support-policy/isc-license/
+//
+// tar - Parsing of the man pages within a tar archive.
+package goman
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Report whether the tar entry 'name' looks like a man page, either by its
+// extension or by being within a manN directory.
+func isTarManPage(name string) bool {
+	if isManFile(path.Base(name)) {
+		return true
+	}
+	dirs := strings.Split(path.Dir(name), "/")
+	return sectdir_re.MatchString(dirs[len(dirs)-1])
+}
+
+// NewManPagesFromTar parses each man page within the tar archive read from
+// 'r', which may itself be compressed, as may its members.  The pages that
+// parse are returned along with the errors of those that did not.
+func NewManPagesFromTar(r io.Reader) ([]*ManPage, error) {
+	rdr, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+
+	var mans []*ManPage
+	var errs []error
+	tr := tar.NewReader(rdr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("error reading tar archive: %w", err))
+			break
+		}
+		if hdr.Typeflag != tar.TypeReg || !isTarManPage(hdr.Name) {
+			continue
+		}
+
+		data, err := readMan(tr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hdr.Name, err))
+			continue
+		}
+		man := ManPage{Path: hdr.Name}
+		man.parse(data)
+		mans = append(mans, &man)
+	}
+	return mans, errors.Join(errs...)
+}
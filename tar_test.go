@@ -0,0 +1,56 @@
+package goman
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+// Return a gzip compressed tar archive holding the files named by the even
+// elements of 'files', with the contents that follow them
+func writeTar(t *testing.T, files ...string) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i := 0; i+1 < len(files); i += 2 {
+		name, data := files[i], files[i+1]
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestNewManPagesFromTar(t *testing.T) {
+	var member bytes.Buffer
+	gz := gzip.NewWriter(&member)
+	gz.Write([]byte(".TH B 3\n.SH NAME\nb \\- second\n"))
+	gz.Close()
+
+	buf := writeTar(t,
+		"usr/share/man/man1/a.1", ".TH A 1\n.SH NAME\na \\- first\n",
+		"usr/share/man/man3/b.3.gz", member.String(),
+		"usr/share/man/man8/c", "\x1f\x8b\x08\x00",
+		"usr/share/doc/README", "not a man page\n")
+	pages, err := NewManPagesFromTar(buf)
+	if err == nil {
+		t.Errorf("NewManPagesFromTar: expected an error for the truncated member\n")
+	}
+	if len(pages) != 2 || pages[0].Name != "a" || pages[1].Name != "b" {
+		t.Fatalf("NewManPagesFromTar: expected [a b], found %v\n", pages)
+	}
+	if pages[1].FileSection != "3" {
+		t.Errorf("FileSection: expected '3', found '%s'\n", pages[1].FileSection)
+	}
+}